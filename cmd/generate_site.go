@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jpiriz/ghcontrib/internal"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var siteOutput string
+var siteItems int
+var siteLocations string
+
+// generateSiteCmd writes a static site with the rankings of some locations
+var generateSiteCmd = &cobra.Command{
+	Use:   "generate-site [location...]",
+	Short: "Generate a static leaderboard site for a list of locations",
+	Long: `Generate a static leaderboard site for a list of locations.
+The rankings are read from the cache or fetched from the Github API, like the API does,
+and written as HTML pages and JSON data files to the output directory.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		locations := args
+		if siteLocations != "" {
+			locations = append(locations, strings.Split(siteLocations, ",")...)
+		}
+		if len(locations) == 0 {
+			return cmd.Usage()
+		}
+		if siteItems < 1 || siteItems > internal.MaxItems {
+			return fmt.Errorf("items must be between 1 and %d", internal.MaxItems)
+		}
+		ctx := context.Background()
+		app, _, err := newApp(ctx, cache.NewKeyBuilder(cachePrefix))
+		if err != nil {
+			return err
+		}
+		if err := app.GenerateSite(ctx, siteOutput, locations, siteItems); err != nil {
+			return err
+		}
+		logrus.WithField("output", siteOutput).Info("Site generated")
+		return nil
+	},
+}
+
+func init() {
+	generateSiteCmd.Flags().StringVar(&siteOutput, "output", "site", "Output directory of the site")
+	generateSiteCmd.Flags().IntVar(&siteItems, "items", 25, "Users of every location")
+	generateSiteCmd.Flags().StringVar(&siteLocations, "locations", "", "Comma separated locations, added to the arguments")
+	rootCmd.AddCommand(generateSiteCmd)
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/internal"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the query command
+const (
+	ExitOK        = 0
+	ExitError     = 1
+	ExitUsage     = 2
+	ExitRateLimit = 3
+)
+
+var queryLocation string
+var queryItems int
+var querySort string
+var queryFilters map[string]string
+var queryOutput string
+var queryFields string
+var queryUseCache bool
+
+// queryCmd prints the top users of a location
+var queryCmd = &cobra.Command{
+	Use:   "query [location]",
+	Short: "Print the top Github users of a location",
+	Long: `Print the top Github users of a location without running the server.
+The users are fetched from the Github API, and from the cache with --use_cache.
+
+Exit codes: 0 success, 1 error, 2 invalid arguments, 3 Github rate limit exceeded.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runQuery(cmd, args))
+	},
+}
+
+//runQuery runs the query command and returns its exit code
+func runQuery(cmd *cobra.Command, args []string) int {
+	if len(args) == 1 {
+		queryLocation = args[0]
+	}
+	q := cache.Query{Location: cache.NormalizeLocation(queryLocation), Sort: querySort, Filters: queryFilters}
+	if q.Location == "" {
+		fmt.Fprintln(os.Stderr, "a location is required")
+		cmd.Usage()
+		return ExitUsage
+	}
+	if err := githubclient.ValidateQuery(q); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitUsage
+	}
+	if queryItems < 1 || queryItems > internal.MaxItems {
+		fmt.Fprintf(os.Stderr, "items must be between 1 and %d\n", internal.MaxItems)
+		return ExitUsage
+	}
+	var fields []string
+	if queryFields != "" {
+		fields = strings.Split(queryFields, ",")
+	}
+	if !queryUseCache {
+		cacheBackend = "none"
+	}
+
+	ctx := context.Background()
+	app, _, err := newApp(ctx, cache.NewKeyBuilder(cachePrefix))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	result, cached, err := app.TopUsers(ctx, q, queryItems)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return errorExitCode(err)
+	}
+	if err := internal.RenderUsers(os.Stdout, queryOutput, fields, result, queryItems, cached); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitUsage
+	}
+	if len(result.Failed) > 0 {
+		logrus.WithField("failed", strings.Join(result.Failed, ",")).Warn("The details of some users could not be fetched")
+	}
+	return ExitOK
+}
+
+//errorExitCode returns the exit code of an error getting the users
+func errorExitCode(err error) int {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var budgetErr *githubclient.BudgetError
+	if errors.As(err, &rateErr) || errors.As(err, &abuseErr) || errors.As(err, &budgetErr) {
+		return ExitRateLimit
+	}
+	return ExitError
+}
+
+func init() {
+	queryCmd.Flags().StringVar(&queryLocation, "location", "", "Location of the users, it can also be the argument")
+	queryCmd.Flags().IntVar(&queryItems, "items", 10, "Number of users")
+	queryCmd.Flags().StringVar(&querySort, "sort", internal.DefaultSort, "Sort of the users: "+strings.Join(githubclient.Sorts, ", "))
+	queryCmd.Flags().StringToStringVar(&queryFilters, "filter", nil, "Search qualifiers as name=value, e.g. language=go,followers=>100. Valid names are "+strings.Join(githubclient.Qualifiers, ", "))
+	queryCmd.Flags().StringVar(&queryOutput, "output", "table", "Output format: table, json, csv, ndjson, markdown")
+	queryCmd.Flags().StringVar(&queryFields, "fields", "", "Comma separated fields or columns to print")
+	queryCmd.Flags().BoolVar(&queryUseCache, "use_cache", false, "Read and store the users in the cache configured by the cache flags")
+	rootCmd.AddCommand(queryCmd)
+}
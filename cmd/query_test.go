@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunQueryUsage(t *testing.T) {
+	defer func(location string, items int, sort string) {
+		queryLocation, queryItems, querySort = location, items, sort
+	}(queryLocation, queryItems, querySort)
+
+	for _, tc := range []struct {
+		name     string
+		location string
+		items    int
+		sort     string
+	}{
+		{"no location", "", 10, "repos"},
+		{"blank location", "  ", 10, "repos"},
+		{"unknown sort", "barcelona", 10, "stars"},
+		{"no items", "barcelona", 0, "repos"},
+		{"too many items", "barcelona", 101, "repos"},
+	} {
+		queryLocation, queryItems, querySort = tc.location, tc.items, tc.sort
+		assert.Equal(t, ExitUsage, runQuery(queryCmd, nil), tc.name)
+	}
+}
+
+func TestErrorExitCode(t *testing.T) {
+	reset := time.Now().Add(time.Minute)
+	rateErr := &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: reset}}, Message: "API rate limit exceeded"}
+	assert.Equal(t, ExitRateLimit, errorExitCode(rateErr))
+	assert.Equal(t, ExitRateLimit, errorExitCode(&github.AbuseRateLimitError{Message: "abuse"}))
+	assert.Equal(t, ExitRateLimit, errorExitCode(&githubclient.BudgetError{Resource: "core", Needed: 101, Remaining: 10, Reset: reset}))
+	assert.Equal(t, ExitRateLimit, errorExitCode(fmt.Errorf("searching users: %w", rateErr)))
+	assert.Equal(t, ExitError, errorExitCode(errors.New("connection refused")))
+}
@@ -19,22 +19,60 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jpiriz/ghcontrib/internal"
+	"github.com/jpiriz/ghcontrib/pkg/apikey"
 	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/jpiriz/ghcontrib/pkg/config"
 	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+	"github.com/jpiriz/ghcontrib/pkg/ratelimit"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+//secretFlags are redacted when the config is printed and can be read from files
+var secretFlags = []string{"github_token", "cache_password", "admin_token"}
+
+var configFile string
+var settings config.Loader
 var githubToken string
+var githubAppID int64
+var githubAppInstallation int64
+var githubAppKeyFile string
+var cacheBackend string
+var cachePath string
 var cacheAddr string
 var cacheDb int
 var cachePassword string
+var cacheSentinelMaster string
+var cacheCluster bool
+var cacheTLS bool
+var cacheTLSCA string
 var cacheObjTTL int
+var cachePartialTTL int
+var cacheNegativeTTL int
+var cacheNegativeLimit int64
+var cacheLockExpiry int
+var cacheLockWait int
+var cacheCodec string
+var cachePrefix string
 var listenAddr string
 var verbose bool
+var adminToken string
+var githubRetries int
+var githubRetryDelay int
+var githubWorkers int
+var apiAuth bool
+var apiKeysFile string
+var apiQuota int64
+var apiQuotaWindow int
+var rateLimitRate float64
+var rateLimitBurst int64
+var rateLimitMissRate float64
+var rateLimitMissBurst int64
+var trustProxy bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -42,6 +80,19 @@ var rootCmd = &cobra.Command{
 	Short: "Application to get top github contributors by City",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		logrus.SetOutput(os.Stdout)
+		settings = config.NewLoader(cmd.Flags(), "config", secretFlags)
+		// The flags of the subcommands are in a section of their name, output is a directory
+		// for generate-site and a format for query
+		for _, sub := range cmd.Root().Commands() {
+			if sub == cmd {
+				settings.Section(sub.Name(), cmd.LocalNonPersistentFlags())
+			} else {
+				settings.Section(sub.Name(), nil)
+			}
+		}
+		if err := settings.Load(); err != nil {
+			return err
+		}
 		loglevel := "INFO"
 		if verbose {
 			loglevel = "DEBUG"
@@ -55,15 +106,123 @@ var rootCmd = &cobra.Command{
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		logrus.Info("Starting GH-Contrib API")
-		var ctx = context.Background()
-		cache := cache.NewRedisCache(cacheAddr, cachePassword)
-		ghClient := githubclient.NewClient(ctx, githubToken)
-
-		app := internal.NewApp(listenAddr, ghClient, cache, time.Duration(cacheObjTTL)*time.Second)
+		keys := cache.NewKeyBuilder(cachePrefix)
+		app, c, err := newApp(context.Background(), keys)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		app.EnableAdmin(adminToken)
+		if apiAuth {
+			stores := apikey.Stores{}
+			if apiKeysFile != "" {
+				fileStore, err := apikey.LoadFile(apiKeysFile)
+				if err != nil {
+					logrus.Fatal(err)
+				}
+				stores = append(stores, fileStore)
+			}
+			stores = append(stores, apikey.NewCacheStore(c, keys))
+			quota, err := apikey.NewQuota(c, keys, time.Duration(apiQuotaWindow)*time.Second, apiQuota)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			app.EnableAPIKeys(stores, quota)
+		}
+		app.EnableRateLimit(
+			newLimiter(c, keys, "requests", rateLimitRate, rateLimitBurst),
+			newLimiter(c, keys, "misses", rateLimitMissRate, rateLimitMissBurst),
+			trustProxy,
+		)
 		app.StartServer()
 	},
 }
 
+//newApp returns the App and its cache configured by the flags, keys builds the cache keys of the App
+func newApp(ctx context.Context, keys cache.KeyBuilder) (internal.App, cache.Cache, error) {
+	codec, err := cache.NewCodec(cacheCodec)
+	if err != nil {
+		return internal.App{}, nil, err
+	}
+
+	lockOptions := cache.DefaultLockOptions()
+	lockOptions.Expiry = time.Duration(cacheLockExpiry) * time.Second
+	lockOptions.Wait = time.Duration(cacheLockWait) * time.Second
+	c, err := newCache(lockOptions)
+	if err != nil {
+		return internal.App{}, nil, err
+	}
+	ghClient, err := newGithubClient(ctx, c, keys)
+	if err != nil {
+		return internal.App{}, nil, err
+	}
+	retryPolicy := githubclient.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = githubRetries
+	retryPolicy.BaseDelay = time.Duration(githubRetryDelay) * time.Millisecond
+	ghClient.SetRetryPolicy(retryPolicy)
+	ghClient.SetWorkers(githubWorkers)
+
+	results := cache.NewResultStore(c, keys, codec)
+	app := internal.NewApp(listenAddr, ghClient, c, results, time.Duration(cacheObjTTL)*time.Second, time.Duration(cachePartialTTL)*time.Second, keys)
+	app.SetNegativeCache(time.Duration(cacheNegativeTTL)*time.Second, cacheNegativeLimit)
+	return app, c, nil
+}
+
+//newGithubClient returns a Github client authenticated as a Github App installation if
+//github_app_id is set, or with the github_token otherwise
+func newGithubClient(ctx context.Context, c cache.Cache, keys cache.KeyBuilder) (*githubclient.Client, error) {
+	if githubAppID == 0 {
+		return githubclient.NewClient(ctx, githubToken, c, keys), nil
+	}
+	if githubToken != "" {
+		return nil, fmt.Errorf("github_token and github_app_id can not be used together")
+	}
+	key, err := githubclient.LoadPrivateKey(githubAppKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the Github App private key: %v", err)
+	}
+	logrus.WithFields(logrus.Fields{"app": githubAppID, "installation": githubAppInstallation}).Info("Using Github App authentication")
+	return githubclient.NewAppClient(ctx, githubclient.AppCredentials{
+		AppID:          githubAppID,
+		InstallationID: githubAppInstallation,
+		PrivateKey:     key,
+	}, c, keys)
+}
+
+//newLimiter returns a per client Limiter, nil if the rate is 0
+func newLimiter(c cache.Cache, keys cache.KeyBuilder, name string, rate float64, burst int64) ratelimit.Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return ratelimit.New(c, keys, ratelimit.Options{Name: name, Rate: rate, Burst: burst})
+}
+
+//newCache returns the cache backend selected by the cache_backend flag
+func newCache(lockOptions cache.LockOptions) (cache.Cache, error) {
+	switch cacheBackend {
+	case "redis":
+		return cache.NewRedisCache(cache.RedisOptions{
+			Addrs:      strings.Split(cacheAddr, ","),
+			Password:   cachePassword,
+			DB:         cacheDb,
+			MasterName: cacheSentinelMaster,
+			Cluster:    cacheCluster,
+			TLS:        cacheTLS,
+			TLSCAFile:  cacheTLSCA,
+			Lock:       lockOptions,
+		})
+	case "bolt":
+		logrus.WithField("path", cachePath).Info("Using bolt cache backend")
+		return cache.NewBoltCache(cachePath, lockOptions)
+	case "none":
+		logrus.Info("Cache disabled")
+		return cache.NopCache{}, nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %q, valid backends are redis, bolt, none", cacheBackend)
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -74,10 +233,41 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "YAML config file, the settings are the flag names. Flags and "+config.EnvPrefix+"* environment variables take precedence")
 	rootCmd.PersistentFlags().StringVar(&githubToken, "github_token", "", "Token for Github Api")
+	rootCmd.PersistentFlags().Int64Var(&githubAppID, "github_app_id", 0, "Github App id, authenticates as an installation of the App instead of using github_token")
+	rootCmd.PersistentFlags().Int64Var(&githubAppInstallation, "github_app_installation_id", 0, "Installation id of the Github App")
+	rootCmd.PersistentFlags().StringVar(&githubAppKeyFile, "github_app_private_key_file", "", "PEM private key file of the Github App")
 	rootCmd.PersistentFlags().StringVar(&listenAddr, "listen_addr", ":10000", "Address where the service should listen")
-	rootCmd.PersistentFlags().StringVar(&cacheAddr, "cache_addr", "localhost:6379", "Cache Host:Port to connect to")
+	rootCmd.PersistentFlags().StringVar(&cacheBackend, "cache_backend", "redis", "Cache backend: redis, bolt or none")
+	rootCmd.PersistentFlags().StringVar(&cachePath, "cache_path", "ghcontrib.db", "Database file of the bolt cache backend")
+	rootCmd.PersistentFlags().StringVar(&cacheAddr, "cache_addr", "localhost:6379", "Cache Host:Port to connect to, comma separated for Sentinel or Cluster")
 	rootCmd.PersistentFlags().StringVar(&cachePassword, "cache_password", "", "Cache password")
+	rootCmd.PersistentFlags().IntVar(&cacheDb, "cache_db", 0, "Cache database index")
+	rootCmd.PersistentFlags().StringVar(&cacheSentinelMaster, "cache_sentinel_master", "", "Redis Sentinel master name, enables Sentinel mode")
+	rootCmd.PersistentFlags().BoolVar(&cacheCluster, "cache_cluster", false, "Connect to a Redis Cluster using cache_addr as seed nodes")
+	rootCmd.PersistentFlags().BoolVar(&cacheTLS, "cache_tls", false, "Use TLS to connect to the cache")
+	rootCmd.PersistentFlags().StringVar(&cacheTLSCA, "cache_tls_ca", "", "CA certificate file to verify the cache server")
 	rootCmd.PersistentFlags().IntVar(&cacheObjTTL, "cache_objttl", 300, "TTL (seconds) for the objects in the cache")
+	rootCmd.PersistentFlags().IntVar(&cacheNegativeTTL, "cache_negative_ttl", 60, "TTL (seconds) for locations without users in the cache, 0 disables caching them")
+	rootCmd.PersistentFlags().Int64Var(&cacheNegativeLimit, "cache_negative_limit", 100, "Maximum locations without users cached per minute, 0 disables the limit")
+	rootCmd.PersistentFlags().IntVar(&cacheLockExpiry, "cache_lock_expiry", 8, "Lease (seconds) of the cache distributed lock, renewed while it is held")
+	rootCmd.PersistentFlags().IntVar(&cacheLockWait, "cache_lock_wait", 10, "Maximum time (seconds) to wait for the cache distributed lock")
+	rootCmd.PersistentFlags().StringVar(&cachePrefix, "cache_prefix", "ghcontrib", "Prefix of the cache keys, isolates environments sharing the cache")
+	rootCmd.PersistentFlags().StringVar(&cacheCodec, "cache_codec", "json", "Codec for the cached users: "+strings.Join(cache.Codecs, ", "))
+	rootCmd.PersistentFlags().IntVar(&githubRetries, "github_retries", 3, "Attempts for each Github Api request, 1 disables retries")
+	rootCmd.PersistentFlags().IntVar(&githubRetryDelay, "github_retry_delay", 500, "Initial backoff (milliseconds) between Github Api retries")
+	rootCmd.PersistentFlags().IntVar(&cachePartialTTL, "cache_partial_ttl", 30, "TTL (seconds) for partial results in the cache, 0 disables caching them")
+	rootCmd.PersistentFlags().IntVar(&githubWorkers, "github_workers", githubclient.DefaultWorkers, "Maximum concurrent Github Users Api requests shared by all the requests")
+	rootCmd.PersistentFlags().StringVar(&adminToken, "admin_token", "", "Bearer token for the /admin endpoints, they are disabled if empty")
+	rootCmd.PersistentFlags().BoolVar(&apiAuth, "api_auth", false, "Require an API key in the "+internal.APIKeyHeader+" header of the requests")
+	rootCmd.PersistentFlags().StringVar(&apiKeysFile, "api_keys_file", "", "JSON file with the API keys, keys are also looked up in the cache")
+	rootCmd.PersistentFlags().Int64Var(&apiQuota, "api_quota", 1000, "Requests allowed per API key in every quota window, unless the key sets its own quota")
+	rootCmd.PersistentFlags().IntVar(&apiQuotaWindow, "api_quota_window", 3600, "Sliding window (seconds) of the API key quotas")
+	rootCmd.PersistentFlags().Float64Var(&rateLimitRate, "ratelimit_rate", 0, "Requests per second allowed to every client, 0 (default) disables the limit")
+	rootCmd.PersistentFlags().Int64Var(&rateLimitBurst, "ratelimit_burst", 20, "Burst of requests allowed to every client")
+	rootCmd.PersistentFlags().Float64Var(&rateLimitMissRate, "ratelimit_miss_rate", 0, "Cache misses per second allowed to every client, they cost Github requests. 0 (default) disables the limit")
+	rootCmd.PersistentFlags().Int64Var(&rateLimitMissBurst, "ratelimit_miss_burst", 5, "Burst of cache misses allowed to every client")
+	rootCmd.PersistentFlags().BoolVar(&trustProxy, "trust_proxy", false, "Identify anonymous clients by the address appended by the proxy to the X-Forwarded-For header")
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "show debug information")
 }
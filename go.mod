@@ -1,6 +1,6 @@
 module github.com/jpiriz/ghcontrib
 
-go 1.13
+go 1.16
 
 require (
 	github.com/alicebob/miniredis/v2 v2.14.1
@@ -8,8 +8,14 @@ require (
 	github.com/go-redsync/redsync/v4 v4.0.4
 	github.com/google/go-github/v32 v32.1.0
 	github.com/gorilla/mux v1.8.0
+	github.com/klauspost/compress v1.11.4
 	github.com/sirupsen/logrus v1.7.0
 	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.6.1
+	github.com/vmihailenco/msgpack/v5 v5.1.0
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/oauth2 v0.0.0-20201203001011-0b49973bad19
+	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/sirupsen/logrus"
+)
+
+//cacheEntry describes a cached location in the admin API
+type cacheEntry struct {
+	Key        string            `json:"key"`
+	Location   string            `json:"location"`
+	Sort       string            `json:"sort"`
+	Filters    map[string]string `json:"filters,omitempty"`
+	TTLSeconds int64             `json:"ttl_seconds"`
+	Items      int               `json:"items"`
+	TotalCount int               `json:"total_count"`
+	Empty      bool              `json:"empty"`
+	FetchedAt  time.Time         `json:"fetched_at"`
+}
+
+//cacheEntryUsers is a cached location with its ranked users
+type cacheEntryUsers struct {
+	cacheEntry
+	Users []*github.User `json:"users"`
+}
+
+//EnableAdmin enables the /admin endpoints, requests must send the token as a Bearer token
+func (app *App) EnableAdmin(token string) {
+	app.adminToken = token
+}
+
+//adminRoutes registers the admin endpoints in the router
+func (app App) adminRoutes(r *mux.Router) {
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(adminAuth(app.adminToken))
+	admin.HandleFunc("/cache", app.adminListHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/cache", app.adminDeletePrefixHandler).Methods(http.MethodDelete)
+	admin.HandleFunc("/cache/{location}", app.adminGetHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/cache/{location}", app.adminDeleteHandler).Methods(http.MethodDelete)
+	admin.HandleFunc("/cache/{location}/refresh", app.adminRefreshHandler).Methods(http.MethodPost)
+	app.adminKeyRoutes(admin)
+}
+
+//adminAuth is a middleware that checks the admin Bearer token
+func adminAuth(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := bearerToken(r)
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				logrus.WithField("path", r.URL.Path).Info("Unauthorized admin request")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//bearerToken returns the token of the Authorization header, the scheme is case insensitive
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.SplitN(strings.TrimSpace(r.Header.Get("Authorization")), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	token := strings.TrimSpace(parts[1])
+	return token, token != ""
+}
+
+//locationQuery returns the query of the location in the request path
+func locationQuery(r *http.Request) cache.Query {
+	return cache.Query{Location: cache.NormalizeLocation(mux.Vars(r)["location"]), Sort: DefaultSort}
+}
+
+//describeEntry gets the TTL and the result of a cached key
+func (app App) describeEntry(ctx context.Context, key string, q cache.Query) (cacheEntry, cache.Result, error) {
+	entry := cacheEntry{Key: key, Location: q.Location, Sort: q.Sort, Filters: q.Filters}
+	ttl, err := app.cache.TTL(ctx, key)
+	if err != nil {
+		return entry, cache.Result{}, err
+	}
+	entry.TTLSeconds = int64(ttl / time.Second)
+	if ttl == cache.NoExpiration {
+		entry.TTLSeconds = -1
+	}
+	result, err := app.results.GetResult(ctx, q)
+	if err != nil {
+		return entry, result, err
+	}
+	entry.Items = len(result.Users)
+	entry.TotalCount = result.TotalCount
+	entry.Empty = result.Empty
+	entry.FetchedAt = result.FetchedAt
+	return entry, result, nil
+}
+
+//adminListHandler lists the cached locations, optionally filtered by a location prefix
+func (app *App) adminListHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rd, status, err := newRenderer(r, cacheEntryColumns)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	keys, err := app.cache.Scan(ctx, app.keys.UsersLocationPattern(r.URL.Query().Get("prefix")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		q, ok := app.keys.ParseUsers(key)
+		if !ok {
+			continue
+		}
+		entry, _, err := app.describeEntry(ctx, key, q)
+		if err != nil {
+			// The key might have expired after the scan
+			logrus.WithField("key", key).Debug("Error describing cache entry")
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	rd.render(w, entries, nil)
+}
+
+//adminGetHandler returns a cached location with its users as they are stored
+func (app *App) adminGetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := locationQuery(r)
+	key := app.keys.Users(q)
+	entry, result, err := app.describeEntry(ctx, key, q)
+	if err != nil {
+		http.Error(w, "location not cached", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(cacheEntryUsers{cacheEntry: entry, Users: result.Users})
+}
+
+//adminDeleteHandler deletes a cached location
+func (app *App) adminDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	key := app.keys.Users(locationQuery(r))
+	if err := app.cache.Delete(r.Context(), key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logrus.WithField("key", key).Info("Cache entry deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//adminDeletePrefixHandler deletes the cached locations starting with the prefix parameter
+//An empty prefix deletes all the locations, the parameter is required to prevent accidents
+func (app *App) adminDeletePrefixHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prefix, ok := r.URL.Query()["prefix"]
+	if !ok {
+		http.Error(w, "prefix parameter is required", http.StatusBadRequest)
+		return
+	}
+	keys, err := app.cache.Scan(ctx, app.keys.UsersLocationPattern(prefix[0]))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(keys) > 0 {
+		if err := app.cache.Delete(ctx, keys...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	logrus.WithFields(logrus.Fields{
+		"prefix":  prefix[0],
+		"deleted": len(keys),
+	}).Info("Cache entries deleted")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": len(keys)})
+}
+
+//adminRefreshHandler fetches a location from the Github API and replaces its cached users
+func (app *App) adminRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := locationQuery(r)
+	if err := app.refreshUsers(ctx, q); err != nil {
+		httpError(w, err)
+		return
+	}
+	entry, _, err := app.describeEntry(ctx, app.keys.Users(q), q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(entry)
+}
+
+//refreshUsers gets the users of a query from the Github API and stores them in the cache
+func (app App) refreshUsers(ctx context.Context, q cache.Query) error {
+	if ok := app.ghClient.CheckRateLimit(); ok {
+		return app.ghClient.GetRateLimitError()
+	}
+	lockKey := app.keys.Lock(q)
+	if lock, err := app.cache.SetLock(ctx, lockKey); err == nil {
+		defer app.releaseCacheLock(lockKey, lock)
+	}
+	result, err := app.fetchFromGithub(ctx, q, MaxItems, false)
+	if err != nil {
+		return err
+	}
+	logrus.WithField("location", q.Location).Info("Refreshing cache entry")
+	return app.setCacheItems(ctx, result)
+}
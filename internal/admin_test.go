@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+	"github.com/stretchr/testify/assert"
+)
+
+//newAdminRouter returns a router with the admin endpoints of the app
+func newAdminRouter(app *App) *mux.Router {
+	app.EnableAdmin("secret")
+	r := mux.NewRouter()
+	app.adminRoutes(r)
+	return r
+}
+
+//adminRequest sends a request with the admin token to a router
+func adminRequest(r http.Handler, method string, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+//putResults stores the results of the locations with one user
+func putResults(t *testing.T, app App, locations ...string) {
+	for _, location := range locations {
+		assert.NoError(t, app.results.PutResult(context.Background(), time.Minute, cache.Result{
+			Query:      cache.Query{Location: location, Sort: DefaultSort},
+			Users:      newUsers("alice"),
+			TotalCount: 1,
+			FetchedAt:  time.Now().UTC(),
+		}))
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	app := newTestApp(t)
+	r := newAdminRouter(&app)
+	for header, want := range map[string]int{
+		"Bearer secret":   http.StatusOK,
+		"bearer secret":   http.StatusOK,
+		"BEARER  secret ": http.StatusOK,
+		"secret":          http.StatusUnauthorized,
+		"Basic secret":    http.StatusUnauthorized,
+		"Bearer":          http.StatusUnauthorized,
+		"Bearer wrong":    http.StatusUnauthorized,
+		"Bearersecret":    http.StatusUnauthorized,
+		"":                http.StatusUnauthorized,
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin/cache", nil)
+		req.Header.Set("Authorization", header)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, header)
+	}
+}
+
+func TestAdminCache(t *testing.T) {
+	app := newTestApp(t)
+	r := newAdminRouter(&app)
+	putResults(t, app, "barcelona", "bari", "madrid")
+
+	var entries []cacheEntry
+	w := adminRequest(r, "GET", "/admin/cache")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Len(t, entries, 3)
+
+	w = adminRequest(r, "GET", "/admin/cache?prefix=bar")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+
+	var entry cacheEntryUsers
+	w = adminRequest(r, "GET", "/admin/cache/Madrid")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	assert.Equal(t, "madrid", entry.Location)
+	assert.Equal(t, 1, entry.Items)
+	assert.True(t, entry.TTLSeconds > 0)
+	assert.Len(t, entry.Users, 1)
+
+	w = adminRequest(r, "DELETE", "/admin/cache/madrid")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = adminRequest(r, "GET", "/admin/cache/madrid")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = adminRequest(r, "DELETE", "/admin/cache")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = adminRequest(r, "DELETE", "/admin/cache?prefix=bar")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted": 2}`, w.Body.String())
+	w = adminRequest(r, "GET", "/admin/cache")
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestAdminRefresh(t *testing.T) {
+	app := newTestApp(t)
+	gh := &fakeGithub{search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		assert.Equal(t, "barcelona", q.Location)
+		assert.False(t, partial)
+		return githubclient.SearchResult{Users: newUsers("alice", "bob"), TotalCount: 2}, nil
+	}}
+	app.ghClient = gh
+	r := newAdminRouter(&app)
+	putResults(t, app, "barcelona")
+
+	var entry cacheEntry
+	w := adminRequest(r, "POST", "/admin/cache/barcelona/refresh")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	assert.Equal(t, 2, entry.Items)
+	assert.Equal(t, int32(1), gh.searches)
+
+	gh.budget = &githubclient.BudgetError{Resource: "core", Reset: time.Now().Add(time.Minute)}
+	gh.search = func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		return githubclient.SearchResult{}, gh.budget
+	}
+	w = adminRequest(r, "POST", "/admin/cache/barcelona/refresh")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestAdminListCluster(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer s.Close()
+	c, err := cache.NewRedisCache(cache.RedisOptions{Addrs: []string{s.Addr()}, Cluster: true, Lock: cache.DefaultLockOptions()})
+	assert.NoError(t, err)
+	keys := cache.NewKeyBuilder("test")
+	codec, _ := cache.NewCodec("json")
+	app := NewApp(":0", nil, c, cache.NewResultStore(c, keys, codec), time.Minute, 10*time.Second, keys)
+	r := newAdminRouter(&app)
+	putResults(t, app, "barcelona", "madrid")
+
+	var entries []cacheEntry
+	w := adminRequest(r, "GET", "/admin/cache")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+}
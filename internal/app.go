@@ -2,49 +2,106 @@ package internal
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v32/github"
 	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/apikey"
 	"github.com/jpiriz/ghcontrib/pkg/cache"
 	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+	"github.com/jpiriz/ghcontrib/pkg/ratelimit"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
-	MaxItems         = 100
-	KeyUsersNotFound = "NoUsersFound"
+	MaxItems = 100
+	// DefaultSort is the Github Search sort of the users
+	DefaultSort = "repos"
+	// FetchPage is the granularity of the number of users fetched on a cache miss
+	FetchPage = 10
+	// FetchTimeout bounds the time a coalesced fetch can take
+	FetchTimeout = 60 * time.Second
+	// NegativeWindow is the window of the negative cache entries limit
+	NegativeWindow = time.Minute
+	// ResultHeader tells if the location has users, as an empty response is ambiguous
+	ResultHeader = "X-Result"
 )
 
+//GithubClient are the Github API calls of the App, it is implemented by githubclient.Client
+type GithubClient interface {
+	SearchUsers(ctx context.Context, query cache.Query, items int, partial bool) (githubclient.SearchResult, error)
+	CheckRateLimit() bool
+	GetRateLimitError() error
+	Forecast(cost githubclient.Cost) error
+	RateLimits() githubclient.RateLimits
+}
+
 type App struct {
-	listenAddr  string
-	ghClient    *githubclient.Client
-	cache       cache.Cache
-	cacheObjTTL time.Duration
+	listenAddr      string
+	ghClient        GithubClient
+	cache           cache.Cache
+	cacheObjTTL     time.Duration
+	cachePartialTTL time.Duration
+	negativeTTL     time.Duration
+	negativeLimit   int64
+	flights         *singleflight.Group
+	pending         *pendingFetches
+	results         cache.ResultStore
+	keys            cache.KeyBuilder
+	adminToken      string
+	apiKeys         apikey.Store
+	quota           apikey.Quota
+	requestLimiter  ratelimit.Limiter
+	missLimiter     ratelimit.Limiter
+	trustProxy      bool
+}
+
+//partialResponse is the envelope returned when partial results are requested
+//Empty is only set when the location has no users, not when all the lookups failed
+type partialResponse struct {
+	Partial bool           `json:"partial"`
+	Failed  []string       `json:"failed"`
+	Empty   bool           `json:"empty"`
+	Users   []*github.User `json:"users"`
 }
 
 //NewApp returns a App
-func NewApp(listenAddr string, ghClient *githubclient.Client, cache cache.Cache, objTTL time.Duration) App {
+//partialTTL is the TTL of the partial results in the cache, 0 disables caching them
+//results stores the ranked users of the queries and keys builds the cache keys
+func NewApp(listenAddr string, ghClient GithubClient, cache cache.Cache, results cache.ResultStore, objTTL time.Duration, partialTTL time.Duration, keys cache.KeyBuilder) App {
 	return App{
-		listenAddr:  listenAddr,
-		ghClient:    ghClient,
-		cache:       cache,
-		cacheObjTTL: objTTL,
+		listenAddr:      listenAddr,
+		ghClient:        ghClient,
+		cache:           cache,
+		cacheObjTTL:     objTTL,
+		cachePartialTTL: partialTTL,
+		negativeTTL:     objTTL,
+		flights:         &singleflight.Group{},
+		pending:         newPendingFetches(),
+		results:         results,
+		keys:            keys,
 	}
 }
 
+//SetNegativeCache configures the caching of the locations without users
+//They are cached with ttl, and at most limit of them are stored every NegativeWindow
+//to prevent random locations from polluting the cache. A limit of 0 disables the limit
+func (app *App) SetNegativeCache(ttl time.Duration, limit int64) {
+	app.negativeTTL = ttl
+	app.negativeLimit = limit
+}
+
 //StartServer starts the Server
 func (app App) StartServer() {
-	r := mux.NewRouter().StrictSlash(false)
-	r.HandleFunc("/top/{location}", app.topContributorsHandler)
-	r.NotFoundHandler = http.HandlerFunc(usage)
 	srv := &http.Server{
-		Handler:      r,
+		Handler:      app.router(),
 		Addr:         app.listenAddr,
 		WriteTimeout: 60 * time.Second,
 		ReadTimeout:  60 * time.Second,
@@ -52,14 +109,35 @@ func (app App) StartServer() {
 	logrus.Fatal(srv.ListenAndServe())
 }
 
-// Just prints the available endpoints
-func usage(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode("/top/{location}?items=10")
+//router returns the routes of the Server
+//The endpoints are served under /v1, the unversioned routes are kept as aliases for the existing clients
+func (app App) router() *mux.Router {
+	r := mux.NewRouter().StrictSlash(false)
+	v1 := r.PathPrefix("/v1").Subrouter()
+	v1.Handle("/top/{location}", app.apiKeyAuth(app.rateLimit(http.HandlerFunc(app.topContributorsV1Handler))))
+	r.Handle("/top/{location}", app.apiKeyAuth(app.rateLimit(http.HandlerFunc(app.topContributorsHandler))))
+	app.badgeRoutes(v1)
+	app.badgeRoutes(r)
+	v1.Handle("/ratelimit", app.apiKeyAuth(app.rateLimit(http.HandlerFunc(app.rateLimitHandler)))).Methods(http.MethodGet)
+	r.Handle("/ratelimit", app.apiKeyAuth(app.rateLimit(http.HandlerFunc(app.rateLimitHandler)))).Methods(http.MethodGet)
+	if app.adminToken != "" {
+		app.adminRoutes(v1)
+		app.adminRoutes(r)
+	}
+	r.HandleFunc("/openapi.json", app.openAPIHandler).Methods(http.MethodGet)
+	r.HandleFunc("/", explorerHandler).Methods(http.MethodGet)
+	r.NotFoundHandler = http.HandlerFunc(notFound)
+	return r
+}
+
+//notFound points to the documentation of the endpoints
+func notFound(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "not found, the endpoints are documented in / and /openapi.json", http.StatusNotFound)
 }
 
-func (app *App) releaseCacheLock(key string) {
+func (app *App) releaseCacheLock(key string, lock cache.Lock) {
 	logrus.WithField("key", key).Debug("Releasing Cache Lock")
-	err := app.cache.ReleaseLock(key)
+	err := lock.Unlock()
 	if err != nil {
 		logrus.Debug("Error Releaseing cache lock")
 		logrus.Error(err)
@@ -68,153 +146,378 @@ func (app *App) releaseCacheLock(key string) {
 	}
 }
 
-func marshalUsers(users []string) []*github.User {
-	cUsers := make([]*github.User, 0)
-	for _, u := range users {
-		var uo github.User
-		json.Unmarshal([]byte(u), &uo)
-		cUsers = append(cUsers, &uo)
+//score returns the value a user is ranked by in a sort
+func score(u *github.User, sort string) float64 {
+	switch sort {
+	case "followers":
+		return float64(u.GetFollowers())
+	case "joined":
+		return float64(u.GetCreatedAt().Unix())
 	}
-	return cUsers
+	return float64(u.GetPublicRepos())
 }
 
-// There is a corner case when a location has no users in github
-// In that case a key with a special value is stored to prevent issue api requests
-// for non-existent locations
-func (app App) getCacheItems(ctx context.Context, key string, items int) ([]*github.User, bool, bool) {
-	cacheHit := false
-	cacheDisabled := false
-	cUsers := make([]*github.User, 0)
-	if isCached, err := app.cache.Exists(ctx, key); err != nil {
-		logrus.Debug("Error getting key from the cache")
-		cacheDisabled = true
-		//return cUsers, cacheDisabled, cacheHit
-	} else {
-		if isCached > 0 {
-			if users, err := app.cache.GetRange(ctx, key, MaxItems); err != nil {
-				if k, err := app.cache.GetKey(ctx, key); err == nil && k == KeyUsersNotFound {
-					logrus.Debug("Cache Key exists, location with no users")
-					cacheHit = true
-				} else {
-					logrus.Debug("Error getting data from the cache")
-					logrus.Error(err)
-					cacheDisabled = true
+//rankUsers sorts the users by their score in the sort of the query, public repos by default
+func rankUsers(users []*github.User, by string) {
+	sort.SliceStable(users, func(i, j int) bool {
+		return score(users[i], by) > score(users[j], by)
+	})
+}
+
+//getCacheItems gets the result of a query from the cache
+//It returns ErrResultNotFound if the result is not cached or it has not enough users,
+//partial results are only returned if partial is set. Any other error means the cache is not available
+func (app App) getCacheItems(ctx context.Context, q cache.Query, items int, partial bool) (cache.Result, error) {
+	result, err := app.results.GetResult(ctx, q)
+	if err == cache.ErrResultNotFound {
+		logrus.WithField("location", q.Location).Debug("Result does not exist in the cache")
+		return result, err
+	} else if err != nil {
+		logrus.Debug("Error getting result from the cache")
+		logrus.Error(err)
+		return result, err
+	}
+	if !result.Serves(items, partial) {
+		logrus.WithField("location", q.Location).Info("Cache Miss, not enough users in cache")
+		return result, cache.ErrResultNotFound
+	}
+	logrus.WithFields(logrus.Fields{
+		"location": q.Location,
+		"empty":    result.Empty,
+	}).Info("Cache Hit")
+	return result, nil
+}
+
+//allowNegativeEntry checks the limit of negative entries stored in the current window
+//The counter is shared by all the replicas, if it is not available the entry is allowed
+func (app App) allowNegativeEntry(ctx context.Context) bool {
+	if app.negativeLimit <= 0 {
+		return true
+	}
+	window := strconv.FormatInt(time.Now().Unix()/int64(NegativeWindow/time.Second), 10)
+	n, err := app.cache.Incr(ctx, NegativeWindow, app.keys.Counter("negative", window))
+	if err != nil {
+		logrus.Debug("Error counting negative cache entries")
+		logrus.Error(err)
+		return true
+	}
+	return n <= app.negativeLimit
+}
+
+//setCacheItems stores a result in the cache
+//Partial results are cached with a shorter TTL so the next calls retry the failed users,
+//locations without users use the negative cache TTL and limit
+func (app App) setCacheItems(ctx context.Context, result cache.Result) error {
+	ttl := app.cacheObjTTL
+	switch {
+	case result.Empty:
+		ttl = app.negativeTTL
+		if ttl > 0 && !app.allowNegativeEntry(ctx) {
+			logrus.WithField("location", result.Query.Location).Info("Negative cache entries limit reached, not caching location")
+			return nil
+		}
+	case len(result.Failed) > 0:
+		ttl = app.cachePartialTTL
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	logrus.Debug("Setting cache value")
+	return app.results.PutResult(ctx, ttl, result)
+}
+
+//fetchFromGithub gets the ranked result of a query from the Github API
+func (app App) fetchFromGithub(ctx context.Context, q cache.Query, items int, partial bool) (cache.Result, error) {
+	found, err := app.ghClient.SearchUsers(ctx, q, items, partial)
+	if err != nil {
+		return cache.Result{}, err
+	}
+	rankUsers(found.Users, q.Sort)
+	return cache.Result{
+		Query:      q,
+		Users:      found.Users,
+		TotalCount: found.TotalCount,
+		Failed:     found.Failed,
+		FetchedAt:  time.Now().UTC(),
+		// Users might be empty because all the lookups failed
+		Empty: found.TotalCount == 0 && len(found.Users) == 0 && len(found.Failed) == 0,
+	}, nil
+}
+
+//fetchUsers gets the result of a query on a cache miss
+//Concurrent calls for the same query in this replica are coalesced, only one of them takes the
+//cache distributed lock and requests the Github API, the others wait and get the same result.
+//The fetch gets the users of the largest waiting request, rounded up to FetchPage, tolerating the
+//failed lookups, the failed users are only returned to the partial requests. A request that joined
+//a running fetch of fewer users waits for the next one.
+//The fetch is not bound to the request context so a canceled request does not fail the waiters.
+//It returns true if the result was stored in the cache by another replica
+func (app *App) fetchUsers(query cache.Query, items int, partial bool, cacheDisabled bool) (cache.Result, bool, error) {
+	lockKey := app.keys.Lock(query)
+	flightKey := app.keys.Users(query)
+	app.pending.add(flightKey, items)
+	defer app.pending.remove(flightKey, items)
+	for {
+		v, err, shared := app.flights.Do(flightKey, func() (interface{}, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), FetchTimeout)
+			defer cancel()
+
+			if cacheDisabled == false {
+				// Set Cache Distributed Lock
+				// The lock lease is renewed while the Github API is requested
+				if lock, err := app.cache.SetLock(ctx, lockKey); err == nil {
+					logrus.Debug("Cache Distributed lock acquired")
+					defer app.releaseCacheLock(lockKey, lock)
+				}
+			}
+
+			size := fetchSize(app.pending.max(flightKey))
+			if cacheDisabled == false {
+				// Get data from the cache
+				// Another replica might has set the data
+				result, err := app.getCacheItems(ctx, query, size, false)
+				if err == nil {
+					return fetched{result: result, cached: true}, nil
 				}
-			} else {
-				if len(users) >= items {
-					logrus.WithField("key", key).Info("Cache Hit")
-					cacheHit = true
-					cUsers = marshalUsers(users)
-				} else {
-					logrus.WithField("key", key).Info("Cache Miss, not enough users in cache")
+				cacheDisabled = err != cache.ErrResultNotFound
+			}
+
+			// Reject the fetches that would run out of the Github rate limit halfway,
+			// the waiters served by the cache above do not need any budget
+			if err := app.ghClient.Forecast(githubclient.SearchCost(size)); err != nil {
+				return nil, err
+			}
+
+			// Get users from the Github API
+			result, err := app.fetchFromGithub(ctx, query, size, true)
+			if err != nil {
+				return nil, err
+			}
+			if cacheDisabled == false {
+				if err = app.setCacheItems(ctx, result); err != nil {
+					logrus.Debug("Error Setting cache value")
+					logrus.Error(err)
 				}
 			}
-		} else {
-			logrus.Debug("Key does not exist in the cache")
-			cacheHit = false
+			return fetched{result: result}, nil
+		})
+		if err != nil {
+			return cache.Result{}, false, err
+		}
+		if shared {
+			logrus.WithField("key", flightKey).Debug("Request coalesced with a running fetch")
+		}
+		f := v.(fetched)
+		if !partial && len(f.result.Failed) > 0 {
+			return cache.Result{}, false, fmt.Errorf("failed to get the details of the users %s", strings.Join(f.result.Failed, ", "))
+		}
+		if f.result.Serves(items, true) {
+			return f.result, f.cached, nil
 		}
+		logrus.WithField("key", flightKey).Debug("Coalesced fetch got fewer users than requested, fetching again")
 	}
-	return cUsers, cacheHit, cacheDisabled
 }
 
-// If users is empty, set a object instead of a list, getCacheItems is aware of this case
-// is not possible to add an empty list to redis with LPush
-func (app App) setCacheItems(ctx context.Context, key string, users []*github.User) error {
-	if len(users) > 0 {
-		stringItems := make([]string, 0)
-		for _, u := range users {
-			s, _ := json.Marshal(u)
-			stringItems = append(stringItems, string(s))
-		}
-		if err := app.cache.Push(ctx, app.cacheObjTTL, key, stringItems...); err != nil {
-			return err
-		} else {
-			return nil
+//fetchSize returns the number of users fetched for a request of items users
+//Rounding them up to FetchPage lets the result serve the close item counts
+func fetchSize(items int) int {
+	size := (items + FetchPage - 1) / FetchPage * FetchPage
+	if size > MaxItems {
+		size = MaxItems
+	}
+	if size < FetchPage {
+		size = FetchPage
+	}
+	return size
+}
+
+//pendingFetches tracks the items of the requests waiting for the fetch of every query
+type pendingFetches struct {
+	mu       sync.Mutex
+	requests map[string][]int
+}
+
+func newPendingFetches() *pendingFetches {
+	return &pendingFetches{requests: make(map[string][]int)}
+}
+
+//add registers a request of items users for a key
+func (p *pendingFetches) add(key string, items int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests[key] = append(p.requests[key], items)
+}
+
+//remove unregisters a request of items users for a key
+func (p *pendingFetches) remove(key string, items int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	requests := p.requests[key]
+	for i, n := range requests {
+		if n == items {
+			requests = append(requests[:i], requests[i+1:]...)
+			break
 		}
+	}
+	if len(requests) == 0 {
+		delete(p.requests, key)
 	} else {
-		logrus.Debug("Location has no users, set a special cache key to control it")
-		if err := app.cache.SetKey(ctx, app.cacheObjTTL, key, KeyUsersNotFound); err != nil {
-			return err
-		} else {
-			return nil
+		p.requests[key] = requests
+	}
+}
+
+//max returns the largest items of the requests of a key
+func (p *pendingFetches) max(key string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	max := 0
+	for _, items := range p.requests[key] {
+		if items > max {
+			max = items
 		}
 	}
+	return max
+}
+
+//fetched is the result of a coalesced fetch
+type fetched struct {
+	result cache.Result
+	cached bool
+}
+
+//httpError writes a Github API error, RateLimit and budget errors are returned as Too Many Requests
+func httpError(w http.ResponseWriter, err error) {
+	if serr, ok := err.(*github.RateLimitError); ok {
+		http.Error(w, serr.Error(), http.StatusTooManyRequests)
+	} else if berr, ok := err.(*githubclient.BudgetError); ok {
+		budgetError(w, berr)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+//loadResult gets the result of a query from the cache or the Github API, cached tells if it was served from the cache
+//It writes the error response and returns false if the result is not available
+func (app *App) loadResult(w http.ResponseWriter, r *http.Request, query cache.Query, items int, partial bool) (result cache.Result, cached bool, ok bool) {
+	//[1] Get Data form the cache
+	result, err := app.getCacheItems(r.Context(), query, items, partial)
+	if err == nil {
+		return result, true, true
+	}
+	cacheDisabled := err != cache.ErrResultNotFound
+	// If system is under RateLimit, return
+	if ok := app.ghClient.CheckRateLimit(); ok {
+		logrus.Debug("RateLimitError Set, Discarting API Requests until RateLimit expiration")
+		logrus.Error(app.ghClient.GetRateLimitError())
+		http.Error(w, app.ghClient.GetRateLimitError().Error(), http.StatusTooManyRequests)
+		return result, false, false
+	}
+	// Cache misses cost Github requests, they have their own budget
+	if !app.allow(w, r, app.missLimiter, "cache miss rate limit exceeded") {
+		return result, false, false
+	}
+
+	//[2] Get Data from the cache or the Github API, coalescing concurrent requests
+	if result, cached, err = app.fetchUsers(query, items, partial, cacheDisabled); err != nil {
+		httpError(w, err)
+		return result, false, false
+	}
+	return result, cached, true
+}
+
+//TopUsers gets the ranked users of a query from the cache or the Github API, cached tells if it was served from the cache
+//The users whose details fail are left out of the result
+func (app *App) TopUsers(ctx context.Context, query cache.Query, items int) (cache.Result, bool, error) {
+	query.Location = cache.NormalizeLocation(query.Location)
+	if query.Sort == "" {
+		query.Sort = DefaultSort
+	}
+	result, err := app.getCacheItems(ctx, query, items, true)
+	if err == nil {
+		return result, true, nil
+	}
+	if ok := app.ghClient.CheckRateLimit(); ok {
+		return result, false, app.ghClient.GetRateLimitError()
+	}
+	return app.fetchUsers(query, items, true, err != cache.ErrResultNotFound)
 }
 
 // Handler that executes the topContributors function
+//The legacy route returns the Github users unless the v1 schema is requested
 func (app *App) topContributorsHandler(w http.ResponseWriter, r *http.Request) {
+	app.topContributors(w, r, wantsV1(r))
+}
+
+//topContributorsV1Handler serves the top contributors in the v1 schema
+func (app *App) topContributorsV1Handler(w http.ResponseWriter, r *http.Request) {
+	app.topContributors(w, r, true)
+}
+
+//topContributors gets the top contributors of a location
+func (app *App) topContributors(w http.ResponseWriter, r *http.Request, v1 bool) {
 	logrus.Info("Serving topContributors Request")
 	ctx := r.Context()
 	select {
 	case <-ctx.Done():
 		logrus.Debug("topContributorsHandler Context canceled")
 	default:
-		location := mux.Vars(r)["location"]
+		location := cache.NormalizeLocation(mux.Vars(r)["location"])
+		query := cache.Query{Location: location, Sort: DefaultSort}
 		items, err := strconv.Atoi(r.URL.Query().Get("items"))
 		if err != nil {
 			items = 10
 		} else if items > MaxItems { //Hard limit the users
 			items = MaxItems
 		}
-		var users = make([]*github.User, 0)
-		cacheDisabled := false
-		cacheHit := false
-		cacheKey := strings.ToUpper(location)
-
-		//[1] Get Data form the cache
-		//users, err = app.getCacheItems(ctx, location, items)
-		users, cacheHit, cacheDisabled = app.getCacheItems(ctx, location, items)
-		if cacheHit == false {
-			// If system is under RateLimit, return
-			if ok := app.ghClient.CheckRateLimit(); ok {
-				logrus.Debug("RateLimitError Set, Discarting API Requests until RateLimit expiration")
-				logrus.Error(app.ghClient.GetRateLimitError())
-				http.Error(w, app.ghClient.GetRateLimitError().Error(), http.StatusTooManyRequests)
-				return
-			}
-
-			if cacheDisabled == false {
-				// Set Cache Distributed Lock
-				if err = app.cache.SetLock(ctx, "mutex-"+cacheKey); err == nil {
-					logrus.Debug("Cache Distributed lock acquired")
-					defer app.releaseCacheLock("mutex-" + cacheKey)
-				}
-
-				// Get data from the cache
-				// Another goroutine might has set the data
-				users, cacheHit, cacheDisabled = app.getCacheItems(ctx, location, items)
-			}
-
-			if cacheHit == false { // Get users from the Github API
-				if users, err = app.ghClient.GetUsersByLocation(ctx, location, items); err != nil {
-					if serr, ok := err.(*github.RateLimitError); ok {
-						http.Error(w, serr.Error(), http.StatusTooManyRequests)
-					} else {
-						http.Error(w, err.Error(), http.StatusInternalServerError)
-					}
-					return
-				}
-			}
+		partial, _ := strconv.ParseBool(r.URL.Query().Get("partial"))
+		columns := userColumns
+		if v1 {
+			columns = userV1Columns
+		}
+		rd, status, err := newRenderer(r, columns)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
 
-			if cacheDisabled == false && cacheHit == false {
-				logrus.Debug("Setting cache value")
-				if err = app.setCacheItems(ctx, location, users); err != nil {
-					logrus.Debug("Error Setting cache value")
-				}
-			}
+		result, cached, ok := app.loadResult(w, r, query, items, partial)
+		if !ok {
+			return
 		}
 
-		// Encode users
-		if len(users) > 0 {
-			sort.SliceStable(users, func(i, j int) bool {
-				return *(users)[i].PublicRepos > *(users)[j].PublicRepos
-			})
+		// Encode users, they are already ranked
+		users := result.Users
+		if users == nil {
+			users = make([]*github.User, 0)
 		}
 		if items <= len(users) {
-			json.NewEncoder(w).Encode(users[:items])
-		} else {
-			json.NewEncoder(w).Encode(users)
+			users = users[:items]
+		}
+		switch {
+		case result.Empty:
+			w.Header().Set(ResultHeader, "no-users")
+		case len(result.Failed) > 0:
+			w.Header().Set(ResultHeader, "partial")
+		default:
+			w.Header().Set(ResultHeader, "found")
+		}
+		if app.setCacheHeaders(w, r, result, app.resultETag(result, items, partial, v1, rd)) {
+			return
+		}
+		if v1 {
+			rd.renderV1(w, result, users, cached)
+			return
+		}
+		var body interface{} = users
+		if partial {
+			body = partialResponse{
+				Partial: len(result.Failed) > 0,
+				Failed:  result.Failed,
+				Empty:   result.Empty,
+				Users:   users,
+			}
 		}
+		rd.render(w, userItems(users), body)
 
 	}
 }
@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+	"github.com/stretchr/testify/assert"
+)
+
+//newTestApp returns an App on a bolt cache in a temporary directory
+func newTestApp(t *testing.T) App {
+	c, err := cache.NewBoltCache(filepath.Join(t.TempDir(), "cache.db"), cache.DefaultLockOptions())
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	keys := cache.NewKeyBuilder("test")
+	codec, _ := cache.NewCodec("json")
+	return NewApp(":0", nil, c, cache.NewResultStore(c, keys, codec), time.Minute, 10*time.Second, keys)
+}
+
+//fakeGithub is a GithubClient that returns the result of search and counts the searches
+type fakeGithub struct {
+	search    func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error)
+	searches  int32
+	rateLimit *github.RateLimitError
+	budget    error
+	limits    githubclient.RateLimits
+}
+
+func (f *fakeGithub) SearchUsers(ctx context.Context, q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+	atomic.AddInt32(&f.searches, 1)
+	return f.search(q, items, partial)
+}
+
+func (f *fakeGithub) CheckRateLimit() bool {
+	return f.rateLimit != nil
+}
+
+func (f *fakeGithub) GetRateLimitError() error {
+	return f.rateLimit
+}
+
+//Forecast returns the budget error, or checks the cost against the core limit when it is known
+func (f *fakeGithub) Forecast(cost githubclient.Cost) error {
+	if f.budget != nil || !f.limits.Core.Known() || cost.Core <= f.limits.Core.Remaining {
+		return f.budget
+	}
+	return &githubclient.BudgetError{Resource: "core", Needed: cost.Core, Remaining: f.limits.Core.Remaining, Reset: f.limits.Core.Reset}
+}
+
+func (f *fakeGithub) RateLimits() githubclient.RateLimits {
+	return f.limits
+}
+
+//newUsers returns users with the logins
+func newUsers(logins ...string) []*github.User {
+	users := make([]*github.User, len(logins))
+	for i, login := range logins {
+		users[i] = &github.User{Login: github.String(login), PublicRepos: github.Int(len(logins) - i)}
+	}
+	return users
+}
+
+//getTop requests the top contributors of a location to the legacy route
+func getTop(app *App, location string, query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/top/"+location+"?"+query, nil)
+	app.topContributorsHandler(w, mux.SetURLVars(r, map[string]string{"location": location}))
+	return w
+}
+
+func TestTopContributorsPartial(t *testing.T) {
+	app := newTestApp(t)
+	gh := &fakeGithub{search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		assert.True(t, partial)
+		return githubclient.SearchResult{Users: newUsers("alice", "carol"), Failed: []string{"bob"}, TotalCount: 3}, nil
+	}}
+	app.ghClient = gh
+
+	w := getTop(&app, "barcelona", "items=3&partial=true")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "partial", w.Header().Get(ResultHeader))
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, true, body["partial"])
+	assert.Equal(t, []interface{}{"bob"}, body["failed"])
+	assert.Equal(t, false, body["empty"])
+	assert.Len(t, body["users"], 2)
+
+	// The partial result is cached with the partial TTL
+	key := app.keys.Users(cache.Query{Location: "barcelona", Sort: DefaultSort})
+	ttl, err := app.cache.TTL(context.Background(), key)
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= app.cachePartialTTL)
+
+	// It is served to the partial requests until it expires
+	w = getTop(&app, "barcelona", "items=3&partial=true")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&gh.searches))
+}
+
+func TestTopContributorsPartialNotCached(t *testing.T) {
+	app := newTestApp(t)
+	app.cachePartialTTL = 0
+	gh := &fakeGithub{search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		return githubclient.SearchResult{Users: newUsers("alice"), Failed: []string{"bob"}, TotalCount: 2}, nil
+	}}
+	app.ghClient = gh
+
+	for i := 0; i < 2; i++ {
+		w := getTop(&app, "barcelona", "items=2&partial=true")
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&gh.searches))
+}
+
+func TestTopContributorsPartialNotServedToFullRequests(t *testing.T) {
+	app := newTestApp(t)
+	gh := &fakeGithub{search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		return githubclient.SearchResult{Users: newUsers("alice"), Failed: []string{"bob"}, TotalCount: 2}, nil
+	}}
+	app.ghClient = gh
+
+	getTop(&app, "barcelona", "items=2&partial=true")
+	w := getTop(&app, "barcelona", "items=2")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "bob")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&gh.searches))
+
+	gh.search = func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		return githubclient.SearchResult{Users: newUsers("alice", "bob"), TotalCount: 2}, nil
+	}
+	w = getTop(&app, "barcelona", "items=2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "found", w.Header().Get(ResultHeader))
+	var users []github.User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	assert.Len(t, users, 2)
+}
+
+func TestFetchUsersCoalescesItems(t *testing.T) {
+	app := newTestApp(t)
+	release := make(chan struct{})
+	logins := make([]string, 500)
+	for i := range logins {
+		logins[i] = fmt.Sprintf("user%d", i)
+	}
+	var sizes []int
+	gh := &fakeGithub{search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		sizes = append(sizes, items)
+		<-release
+		return githubclient.SearchResult{Users: newUsers(logins[:items]...), TotalCount: len(logins)}, nil
+	}}
+	app.ghClient = gh
+
+	var wg sync.WaitGroup
+	queries := []string{"items=5", "items=10", "items=50&partial=true", "items=100", "", "items=30&partial=true"}
+	codes := make([]int, len(queries))
+	counts := make([]int, len(queries))
+	get := func(i int) {
+		defer wg.Done()
+		w := getTop(&app, "barcelona", queries[i])
+		codes[i] = w.Code
+		var body struct {
+			Users []github.User `json:"users"`
+		}
+		if strings.Contains(queries[i], "partial") {
+			json.Unmarshal(w.Body.Bytes(), &body)
+		} else {
+			json.Unmarshal(w.Body.Bytes(), &body.Users)
+		}
+		counts[i] = len(body.Users)
+	}
+	// The first request starts a fetch of its items, the others join it
+	wg.Add(len(queries))
+	go get(0)
+	for atomic.LoadInt32(&gh.searches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i < len(queries); i++ {
+		go get(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// The requests that needed more users than the first fetch got them in a single second fetch
+	assert.Equal(t, []int{10, 100}, sizes)
+	assert.Equal(t, []int{200, 200, 200, 200, 200, 200}, codes)
+	assert.Equal(t, []int{5, 10, 50, 100, 10, 30}, counts)
+	assert.Empty(t, app.pending.requests)
+}
+
+func TestFetchSize(t *testing.T) {
+	for items, want := range map[int]int{0: 10, 1: 10, 10: 10, 11: 20, 25: 30, 99: 100, 100: 100, 150: 100} {
+		assert.Equal(t, want, fetchSize(items), items)
+	}
+}
+
+//failingCache is a cache whose counters are not available
+type failingCache struct {
+	cache.NopCache
+}
+
+func (failingCache) Incr(ctx context.Context, ttl time.Duration, key string) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestAllowNegativeEntry(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t)
+	assert.True(t, app.allowNegativeEntry(ctx))
+
+	app.negativeLimit = 2
+	assert.True(t, app.allowNegativeEntry(ctx))
+	assert.True(t, app.allowNegativeEntry(ctx))
+	assert.False(t, app.allowNegativeEntry(ctx))
+
+	// The entries are allowed when the counter is not available
+	app.cache = failingCache{}
+	assert.True(t, app.allowNegativeEntry(ctx))
+}
+
+func TestNegativeEntriesLimit(t *testing.T) {
+	app := newTestApp(t)
+	app.SetNegativeCache(time.Minute, 1)
+	app.ghClient = &fakeGithub{search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		return githubclient.SearchResult{}, nil
+	}}
+
+	getTop(&app, "nowhere", "")
+	getTop(&app, "atlantis", "")
+	ctx := context.Background()
+	_, err := app.results.GetResult(ctx, cache.Query{Location: "nowhere", Sort: DefaultSort})
+	assert.NoError(t, err)
+	_, err = app.results.GetResult(ctx, cache.Query{Location: "atlantis", Sort: DefaultSort})
+	assert.Equal(t, cache.ErrResultNotFound, err)
+}
+
+func TestResultHeader(t *testing.T) {
+	app := newTestApp(t)
+	results := map[string]githubclient.SearchResult{
+		"barcelona": {Users: newUsers("alice", "bob"), TotalCount: 2},
+		"nowhere":   {},
+		"madrid":    {Users: newUsers("alice"), Failed: []string{"bob"}, TotalCount: 2},
+	}
+	app.ghClient = &fakeGithub{search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+		return results[q.Location], nil
+	}}
+
+	for location, want := range map[string]string{"barcelona": "found", "nowhere": "no-users", "madrid": "partial"} {
+		// The second request is served from the cache
+		for i := 0; i < 2; i++ {
+			w := getTop(&app, location, "partial=true")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, want, w.Header().Get(ResultHeader), location)
+		}
+	}
+}
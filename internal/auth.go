@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/apikey"
+	"github.com/sirupsen/logrus"
+)
+
+//APIKeyHeader is the header with the API key of the requests
+const APIKeyHeader = "X-API-Key"
+
+//clientKey is the context key of the API key of a request
+type clientKey struct{}
+
+//EnableAPIKeys requires an API key in the requests, looked up in store and limited by quota
+func (app *App) EnableAPIKeys(store apikey.Store, quota apikey.Quota) {
+	app.apiKeys = store
+	app.quota = quota
+}
+
+//requestKey returns the API key of an authenticated request
+func requestKey(ctx context.Context) (apikey.Key, bool) {
+	k, ok := ctx.Value(clientKey{}).(apikey.Key)
+	return k, ok
+}
+
+//setQuotaHeaders sets the quota headers of a response
+func setQuotaHeaders(w http.ResponseWriter, usage apikey.Usage) {
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(usage.Limit, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(usage.Remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(usage.Reset.Unix(), 10))
+}
+
+//apiKeyAuth is a middleware that checks the API key of the requests and takes them from its quota
+//If the quota counters are not available the requests are allowed
+func (app App) apiKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.apiKeys == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		token := r.Header.Get(APIKeyHeader)
+		if token == "" {
+			http.Error(w, "missing api key", http.StatusUnauthorized)
+			return
+		}
+		k, err := app.apiKeys.Lookup(ctx, token)
+		if err == apikey.ErrKeyNotFound {
+			logrus.WithField("path", r.URL.Path).Info("Request with invalid api key")
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			logrus.Debug("Error looking up api key")
+			logrus.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		usage, ok, err := app.quota.Take(ctx, k)
+		if err != nil {
+			logrus.WithField("client", k.Name).Debug("Error counting api key request")
+			logrus.Error(err)
+		}
+		setQuotaHeaders(w, usage)
+		if !ok {
+			logrus.WithField("client", k.Name).Info("Api key quota exceeded")
+			retry := int64(time.Until(usage.Reset)/time.Second) + 1
+			w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+			http.Error(w, "api key quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, clientKey{}, k)))
+	})
+}
+
+//newKeyRequest is the body to create an API key
+type newKeyRequest struct {
+	Name  string `json:"name"`
+	Quota int64  `json:"quota"`
+}
+
+//newKeyResponse has the token of a new API key, it can not be retrieved later
+type newKeyResponse struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Quota int64  `json:"quota,omitempty"`
+	Key   string `json:"key"`
+}
+
+//adminKeyRoutes registers the endpoints to manage the API keys stored in the cache
+func (app App) adminKeyRoutes(admin *mux.Router) {
+	admin.HandleFunc("/keys", app.adminCreateKeyHandler).Methods(http.MethodPost)
+	admin.HandleFunc("/keys/{id}", app.adminGetKeyHandler).Methods(http.MethodGet)
+	admin.HandleFunc("/keys/{id}", app.adminDeleteKeyHandler).Methods(http.MethodDelete)
+}
+
+//adminCreateKeyHandler generates an API key and stores it in the cache
+func (app *App) adminCreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req newKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "body must be a json object with a name", http.StatusBadRequest)
+		return
+	}
+	token, err := apikey.Generate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	store := apikey.NewCacheStore(app.cache, app.keys)
+	id, err := store.Put(r.Context(), token, apikey.Key{Name: req.Name, Quota: req.Quota})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logrus.WithField("client", req.Name).Info("Api key created")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newKeyResponse{ID: id, Name: req.Name, Quota: req.Quota, Key: token})
+}
+
+//adminGetKeyHandler returns an API key stored in the cache
+func (app *App) adminGetKeyHandler(w http.ResponseWriter, r *http.Request) {
+	store := apikey.NewCacheStore(app.cache, app.keys)
+	k, err := store.Get(r.Context(), mux.Vars(r)["id"])
+	if err == apikey.ErrKeyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(k)
+}
+
+//adminDeleteKeyHandler revokes an API key stored in the cache
+func (app *App) adminDeleteKeyHandler(w http.ResponseWriter, r *http.Request) {
+	store := apikey.NewCacheStore(app.cache, app.keys)
+	if err := store.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logrus.WithField("id", mux.Vars(r)["id"]).Info("Api key revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
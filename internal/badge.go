@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+)
+
+const (
+	// BadgeMaxAge is the minimum freshness of the badges, they are embedded in READMEs and proxied by CDNs
+	BadgeMaxAge = time.Hour
+	// BadgeStaleAge is the time a stale badge can be served while it is revalidated or on errors
+	BadgeStaleAge = 24 * time.Hour
+	// DefaultBadgeItems is the number of users a badge ranks the user in
+	DefaultBadgeItems = 25
+	// DefaultCardItems is the number of users of a card
+	DefaultCardItems = 5
+	// MaxCardItems is the maximum number of users of a card
+	MaxCardItems = 25
+)
+
+//theme are the colors of a badge or a card
+type theme struct {
+	background string
+	text       string
+	muted      string
+	label      string
+	value      string
+	border     string
+}
+
+//themes are the themes of the theme parameter
+var themes = map[string]theme{
+	"light": {background: "#ffffff", text: "#24292e", muted: "#586069", label: "#555555", value: "#2ea44f", border: "#e1e4e8"},
+	"dark":  {background: "#0d1117", text: "#c9d1d9", muted: "#8b949e", label: "#30363d", value: "#238636", border: "#30363d"},
+	"blue":  {background: "#f1f8ff", text: "#032f62", muted: "#586069", label: "#24292e", value: "#0366d6", border: "#c8e1ff"},
+}
+
+//unrankedColor is the value color of the badges of users out of the ranking
+const unrankedColor = "#9f9f9f"
+
+//sizes are the font sizes of the size parameter
+var sizes = map[string]float64{
+	"small":  11,
+	"medium": 13,
+	"large":  16,
+}
+
+//svgStyle are the theme and the font size selected in a request
+type svgStyle struct {
+	theme theme
+	font  float64
+}
+
+//parseStyle returns the style of the theme and size parameters
+func parseStyle(r *http.Request) (svgStyle, error) {
+	style := svgStyle{theme: themes["light"], font: sizes["small"]}
+	if name := r.URL.Query().Get("theme"); name != "" {
+		t, ok := themes[name]
+		if !ok {
+			return style, fmt.Errorf("unknown theme %q, valid themes are light, dark, blue", name)
+		}
+		style.theme = t
+	}
+	if name := r.URL.Query().Get("size"); name != "" {
+		font, ok := sizes[name]
+		if !ok {
+			return style, fmt.Errorf("unknown size %q, valid sizes are small, medium, large", name)
+		}
+		style.font = font
+	}
+	return style, nil
+}
+
+//textWidth estimates the width of a text, the badges use a sans-serif font without measuring it
+func (s svgStyle) textWidth(text string) float64 {
+	return float64(len([]rune(text))) * s.font * 0.62
+}
+
+//escape escapes a text for the SVG documents
+func escape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+//badgeRoutes registers the badge and card endpoints, they are public to be embedded in READMEs unless API keys are required
+func (app App) badgeRoutes(r *mux.Router) {
+	r.Handle("/badge/{location}/{login}.svg", app.rateLimit(http.HandlerFunc(app.badgeHandler))).Methods(http.MethodGet)
+	r.Handle("/card/{location}.svg", app.rateLimit(http.HandlerFunc(app.cardHandler))).Methods(http.MethodGet)
+}
+
+//itemsParam returns the items parameter of a request, def if it is not valid, capped to max
+func itemsParam(r *http.Request, def int, max int) int {
+	items, err := strconv.Atoi(r.URL.Query().Get("items"))
+	if err != nil || items < 1 {
+		return def
+	} else if items > max {
+		return max
+	}
+	return items
+}
+
+//renderBadge returns a shields style badge with a label and a value
+func (s svgStyle) renderBadge(label string, value string, color string) []byte {
+	pad := s.font * 0.6
+	height := s.font * 1.8
+	lw := s.textWidth(label) + 2*pad
+	vw := s.textWidth(value) + 2*pad
+	baseline := height/2 + s.font*0.35
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" role="img" aria-label="%s: %s">`, lw+vw, height, escape(label), escape(value))
+	fmt.Fprintf(&b, `<title>%s: %s</title>`, escape(label), escape(value))
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%.0f" height="%.0f" rx="3" fill="#fff"/></clipPath>`, lw+vw, height)
+	fmt.Fprintf(&b, `<g clip-path="url(#r)"><rect width="%.1f" height="%.0f" fill="%s"/><rect x="%.1f" width="%.1f" height="%.0f" fill="%s"/></g>`, lw, height, s.theme.label, lw, vw, height, color)
+	fmt.Fprintf(&b, `<g fill="#fff" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="%.0f">`, s.font)
+	fmt.Fprintf(&b, `<text x="%.1f" y="%.1f">%s</text><text x="%.1f" y="%.1f">%s</text></g></svg>`, pad, baseline, escape(label), lw+pad, baseline, escape(value))
+	return b.Bytes()
+}
+
+//renderCard returns a leaderboard card with the first users of a result
+func (s svgStyle) renderCard(location string, result cache.Result, items int) []byte {
+	title := fmt.Sprintf("Top Github users in %s", location)
+	row := s.font * 1.9
+	pad := s.font
+	header := s.font * 2.8
+	users := result.Users
+	if len(users) > items {
+		users = users[:items]
+	}
+	lines := len(users)
+	if lines == 0 {
+		lines = 1
+	}
+
+	width := s.textWidth(title) + 2*pad
+	for _, u := range users {
+		if w := s.textWidth(fmt.Sprintf("#%d %s %d repos", MaxCardItems, u.GetLogin(), u.GetPublicRepos())) + 3*pad; w > width {
+			width = w
+		}
+	}
+	height := header + float64(lines)*row + pad
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" role="img" aria-label="%s">`, width, height, escape(title))
+	fmt.Fprintf(&b, `<title>%s</title>`, escape(title))
+	fmt.Fprintf(&b, `<rect x="0.5" y="0.5" width="%.0f" height="%.0f" rx="6" fill="%s" stroke="%s"/>`, width-1, height-1, s.theme.background, s.theme.border)
+	fmt.Fprintf(&b, `<g font-family="Segoe UI,Helvetica,Arial,sans-serif" font-size="%.0f">`, s.font)
+	fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" font-size="%.0f" font-weight="bold" fill="%s">%s</text>`, pad, header*0.6, s.font*1.2, s.theme.value, escape(title))
+	if len(users) == 0 {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="%s">No users found</text>`, pad, header+row*0.6, s.theme.muted)
+	}
+	for i, u := range users {
+		y := header + float64(i)*row + row*0.6
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="%s">#%d</text>`, pad, y, s.theme.muted, i+1)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`, pad+s.textWidth("#25 "), y, s.theme.text, escape(u.GetLogin()))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end" fill="%s">%d repos</text>`, width-pad, y, s.theme.muted, u.GetPublicRepos())
+	}
+	b.WriteString(`</g></svg>`)
+	return b.Bytes()
+}
+
+//writeSVG writes an SVG of a result with its caching headers and its ETag
+//The badges are only rendered from complete results, so they get long lived caching headers
+func (app App) writeSVG(w http.ResponseWriter, r *http.Request, result cache.Result, svg []byte) {
+	sum := sha1.Sum(svg)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	maxAge := app.maxAge(r.Context(), result.Query)
+	if maxAge < BadgeMaxAge {
+		maxAge = BadgeMaxAge
+	}
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d, stale-if-error=%d",
+		int64(maxAge/time.Second), int64(BadgeStaleAge/time.Second), int64(BadgeStaleAge/time.Second)))
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && matchETag(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(svg)
+}
+
+//badgeHandler serves the rank of a user in the first items users of a location
+func (app *App) badgeHandler(w http.ResponseWriter, r *http.Request) {
+	style, err := parseStyle(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := itemsParam(r, DefaultBadgeItems, MaxItems)
+	result, _, ok := app.loadResult(w, r, locationQuery(r), items, false)
+	if !ok {
+		return
+	}
+	login := mux.Vars(r)["login"]
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		label = mux.Vars(r)["location"]
+	}
+	value, color := fmt.Sprintf("not in top %d", items), unrankedColor
+	for i, u := range result.Users {
+		if i >= items {
+			break
+		}
+		if strings.EqualFold(u.GetLogin(), login) {
+			value, color = fmt.Sprintf("#%d by %s", i+1, DefaultSort), style.theme.value
+			break
+		}
+	}
+	app.writeSVG(w, r, result, style.renderBadge(label, value, color))
+}
+
+//cardHandler serves a leaderboard of a location
+func (app *App) cardHandler(w http.ResponseWriter, r *http.Request) {
+	style, err := parseStyle(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items := itemsParam(r, DefaultCardItems, MaxCardItems)
+	result, _, ok := app.loadResult(w, r, locationQuery(r), items, false)
+	if !ok {
+		return
+	}
+	app.writeSVG(w, r, result, style.renderCard(mux.Vars(r)["location"], result, items))
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/pkg/apikey"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+//hostile are logins and labels trying to break out of the SVG
+var hostile = []string{`<script>alert(1)</script>`, `"onload="alert(1)`, `a&b`, `]]><x/>`}
+
+//assertValidXML checks an SVG is well formed and has no injected elements
+func assertValidXML(t *testing.T, svg []byte) {
+	d := xml.NewDecoder(strings.NewReader(string(svg)))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		if el, ok := tok.(xml.StartElement); ok {
+			assert.NotEqual(t, "script", el.Name.Local)
+			assert.NotEqual(t, "x", el.Name.Local)
+			for _, attr := range el.Attr {
+				assert.NotEqual(t, "onload", attr.Name.Local)
+			}
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, "&lt;b&gt; &amp; &#34;q&#34; &#39;s&#39;", escape(`<b> & "q" 's'`))
+	assert.Equal(t, "barcelona", escape("barcelona"))
+}
+
+func TestRenderBadgeHostileLabels(t *testing.T) {
+	style := svgStyle{theme: themes["dark"], font: sizes["large"]}
+	for _, text := range hostile {
+		svg := style.renderBadge(text, text, "#fff")
+		assertValidXML(t, svg)
+		assert.NotContains(t, string(svg), text)
+	}
+}
+
+func TestRenderCardHostileLogins(t *testing.T) {
+	style := svgStyle{theme: themes["light"], font: sizes["small"]}
+	var users []*github.User
+	for _, login := range hostile {
+		users = append(users, &github.User{Login: github.String(login), PublicRepos: github.Int(3)})
+	}
+	svg := style.renderCard(hostile[0], cache.Result{Users: users}, len(users))
+	assertValidXML(t, svg)
+	for _, login := range hostile {
+		assert.NotContains(t, string(svg), login)
+	}
+
+	empty := style.renderCard("nowhere", cache.Result{Empty: true}, DefaultCardItems)
+	assertValidXML(t, empty)
+	assert.Contains(t, string(empty), "No users found")
+}
+
+func TestParseStyle(t *testing.T) {
+	style, err := parseStyle(httptest.NewRequest("GET", "/v1/card/barcelona.svg?theme=blue&size=medium", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, themes["blue"], style.theme)
+	assert.Equal(t, sizes["medium"], style.font)
+
+	_, err = parseStyle(httptest.NewRequest("GET", "/v1/card/barcelona.svg?theme=pink", nil))
+	assert.Error(t, err)
+	_, err = parseStyle(httptest.NewRequest("GET", "/v1/card/barcelona.svg?size=huge", nil))
+	assert.Error(t, err)
+}
+
+func TestWriteSVGNotModified(t *testing.T) {
+	app := App{cache: cache.NopCache{}, keys: cache.NewKeyBuilder("test")}
+	result := cache.Result{Query: cache.Query{Location: "barcelona", Sort: DefaultSort}}
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+
+	w := httptest.NewRecorder()
+	app.writeSVG(w, httptest.NewRequest("GET", "/v1/card/barcelona.svg", nil), result, svg)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "stale-if-error")
+
+	r := httptest.NewRequest("GET", "/v1/card/barcelona.svg", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	app.writeSVG(w, r, result, svg)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestBadgesWithoutAPIKey(t *testing.T) {
+	app := newTestApp(t)
+	quota, err := apikey.NewQuota(app.cache, app.keys, time.Minute, 100)
+	assert.NoError(t, err)
+	app.EnableAPIKeys(apikey.NewCacheStore(app.cache, app.keys), quota)
+	putResults(t, app, "barcelona")
+	r := app.router()
+
+	// The images are embedded in pages that can not send the API key
+	for _, path := range []string{"/v1/badge/barcelona/alice.svg", "/badge/barcelona/alice.svg", "/v1/card/barcelona.svg"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Regexp(t, `^public, max-age=`, w.Header().Get("Cache-Control"), path)
+		assert.Contains(t, w.Body.String(), "<svg", path)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/top/barcelona", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+)
+
+//rateLimitStatus is the response of the ratelimit endpoint
+type rateLimitStatus struct {
+	// The buckets are null until the service requests the resource
+	Core   *githubclient.Bucket `json:"core"`
+	Search *githubclient.Bucket `json:"search"`
+	// Limited is true while the Github API rejects the requests
+	Limited  bool      `json:"limited"`
+	Forecast *forecast `json:"forecast,omitempty"`
+}
+
+//forecast tells if a search of items users fits in the remaining rate limits
+//Search and Core are the cost of the fetch of a cache miss, that gets the items rounded up to FetchPage
+type forecast struct {
+	Items    int        `json:"items"`
+	Search   int        `json:"search"`
+	Core     int        `json:"core"`
+	Fits     bool       `json:"fits"`
+	Resource string     `json:"resource,omitempty"`
+	RetryAt  *time.Time `json:"retry_at,omitempty"`
+}
+
+//budgetError writes the error of an operation that does not fit in the Github rate limits
+func budgetError(w http.ResponseWriter, err *githubclient.BudgetError) {
+	retry := int64(time.Until(err.Reset)/time.Second) + 1
+	if retry < 1 {
+		retry = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+//rateLimitHandler serves the Github rate limits seen by the service,
+//with the items parameter it forecasts if a cache miss of that many users would be admitted
+func (app *App) rateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	limits := app.ghClient.RateLimits()
+	status := rateLimitStatus{Limited: app.ghClient.CheckRateLimit()}
+	if limits.Core.Known() {
+		status.Core = &limits.Core
+	}
+	if limits.Search.Known() {
+		status.Search = &limits.Search
+	}
+	if v := r.URL.Query().Get("items"); v != "" {
+		items, err := strconv.Atoi(v)
+		if err != nil || items < 1 || items > MaxItems {
+			http.Error(w, "items must be between 1 and "+strconv.Itoa(MaxItems), http.StatusBadRequest)
+			return
+		}
+		cost := githubclient.SearchCost(fetchSize(items))
+		status.Forecast = &forecast{Items: items, Search: cost.Search, Core: cost.Core, Fits: true}
+		if err, ok := app.ghClient.Forecast(cost).(*githubclient.BudgetError); ok {
+			status.Forecast.Fits = false
+			status.Forecast.Resource = err.Resource
+			status.Forecast.RetryAt = &err.Reset
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(status)
+}
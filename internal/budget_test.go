@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/apikey"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetError(t *testing.T) {
+	for reset, want := range map[time.Duration]int{
+		90 * time.Second: 91,
+		0:                1,
+		-time.Minute:     1,
+	} {
+		w := httptest.NewRecorder()
+		budgetError(w, &githubclient.BudgetError{Resource: "core", Needed: 101, Remaining: 10, Reset: time.Now().Add(reset)})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		assert.NoError(t, err)
+		// The second might change while the header is written
+		assert.InDelta(t, want, retry, 1, reset.String())
+		assert.Contains(t, w.Body.String(), "core")
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	app := newTestApp(t)
+	reset := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	gh := &fakeGithub{limits: githubclient.RateLimits{Core: githubclient.Bucket{Limit: 5000, Remaining: 50, Reset: reset}}}
+	app.ghClient = gh
+
+	var status rateLimitStatus
+	w := httptest.NewRecorder()
+	app.rateLimitHandler(w, httptest.NewRequest("GET", "/v1/ratelimit", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, 50, status.Core.Remaining)
+	assert.Nil(t, status.Search)
+	assert.False(t, status.Limited)
+	assert.Nil(t, status.Forecast)
+
+	w = httptest.NewRecorder()
+	app.rateLimitHandler(w, httptest.NewRequest("GET", "/v1/ratelimit?items=25", nil))
+	status = rateLimitStatus{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, &forecast{Items: 25, Search: 1, Core: 30, Fits: true}, status.Forecast)
+
+	w = httptest.NewRecorder()
+	app.rateLimitHandler(w, httptest.NewRequest("GET", "/v1/ratelimit?items=45", nil))
+	status = rateLimitStatus{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, 50, status.Forecast.Core)
+	assert.True(t, status.Forecast.Fits)
+
+	w = httptest.NewRecorder()
+	app.rateLimitHandler(w, httptest.NewRequest("GET", "/v1/ratelimit?items=51", nil))
+	status = rateLimitStatus{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.False(t, status.Forecast.Fits)
+	assert.Equal(t, "core", status.Forecast.Resource)
+	assert.True(t, reset.Equal(*status.Forecast.RetryAt))
+
+	for _, items := range []string{"0", "101", "many"} {
+		w = httptest.NewRecorder()
+		app.rateLimitHandler(w, httptest.NewRequest("GET", "/v1/ratelimit?items="+items, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, items)
+	}
+}
+
+func TestRateLimitForecastMatchesAdmission(t *testing.T) {
+	app := newTestApp(t)
+	app.ghClient = &fakeGithub{
+		search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+			return githubclient.SearchResult{Users: newUsers("alice"), TotalCount: 1}, nil
+		},
+		limits: githubclient.RateLimits{Core: githubclient.Bucket{Limit: 5000, Remaining: 50, Reset: time.Now().Add(time.Hour)}},
+	}
+
+	for i, items := range []int{1, 10, 20, 45, 50, 51, 100} {
+		var status rateLimitStatus
+		w := httptest.NewRecorder()
+		app.rateLimitHandler(w, httptest.NewRequest("GET", "/v1/ratelimit?items="+strconv.Itoa(items), nil))
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+
+		// Every location is a cache miss
+		w = getTop(&app, "location"+strconv.Itoa(i), "items="+strconv.Itoa(items))
+		assert.Equal(t, status.Forecast.Fits, w.Code == http.StatusOK, items)
+		if !status.Forecast.Fits {
+			assert.Equal(t, http.StatusTooManyRequests, w.Code, items)
+		}
+	}
+}
+
+func TestRateLimitRequiresAPIKey(t *testing.T) {
+	app := newTestApp(t)
+	app.ghClient = &fakeGithub{}
+	store := apikey.NewCacheStore(app.cache, app.keys)
+	_, err := store.Put(context.Background(), "token", apikey.Key{Name: "ci"})
+	assert.NoError(t, err)
+	quota, err := apikey.NewQuota(app.cache, app.keys, time.Minute, 100)
+	assert.NoError(t, err)
+	app.EnableAPIKeys(store, quota)
+	r := app.router()
+
+	for _, path := range []string{"/v1/ratelimit", "/ratelimit"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(APIKeyHeader, "token")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
+
+func TestForecastOnlyRejectsFetches(t *testing.T) {
+	app := newTestApp(t)
+	gh := &fakeGithub{
+		search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+			return githubclient.SearchResult{Users: newUsers("alice"), TotalCount: 1}, nil
+		},
+		budget: &githubclient.BudgetError{Resource: "core", Needed: 101, Remaining: 10, Reset: time.Now().Add(time.Minute)},
+	}
+	app.ghClient = gh
+
+	w := getTop(&app, "barcelona", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, int32(0), gh.searches)
+
+	// A cached location does not need any budget
+	putResults(t, app, "barcelona")
+	w = getTop(&app, "barcelona", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
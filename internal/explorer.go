@@ -0,0 +1,16 @@
+package internal
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//explorerHTML is the API explorer, it renders the endpoints of the OpenAPI document
+//go:embed assets/explorer.html
+var explorerHTML []byte
+
+//explorerHandler serves the API explorer
+func explorerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(explorerHTML)
+}
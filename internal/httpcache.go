@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+)
+
+//resultETag returns the ETag of a representation of a result
+//A stored result does not change until it is fetched again, so it is identified by its query and fetch time.
+//The ETag is weak because the metadata of the v1 envelope changes when the result is served from the cache
+func (app App) resultETag(result cache.Result, items int, partial bool, v1 bool, rd renderer) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s|%d|%d|%t|%t|%s|%s", app.keys.Users(result.Query), result.FetchedAt.UnixNano(),
+		items, partial, v1, rd.format, strings.Join(rd.header(), ","))
+	return `W/"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+//matchETag checks if an If-None-Match header matches an ETag using the weak comparison
+func matchETag(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+//maxAge returns the remaining TTL of a cached result, 0 if it is not cached
+func (app App) maxAge(ctx context.Context, q cache.Query) time.Duration {
+	ttl, err := app.cache.TTL(ctx, app.keys.Users(q))
+	if err != nil || ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+//setCacheHeaders sets the validators and the freshness of a result response
+//It writes a 304 and returns true when the request preconditions match the result
+func (app App) setCacheHeaders(w http.ResponseWriter, r *http.Request, result cache.Result, etag string) bool {
+	modified := result.FetchedAt.UTC().Truncate(time.Second)
+	visibility := "public"
+	if app.apiKeys != nil {
+		// Shared caches would serve the responses without checking the API keys
+		visibility = "private"
+	}
+	if age := app.maxAge(r.Context(), result.Query); age > 0 {
+		w.Header().Set("Cache-Control", visibility+", max-age="+strconv.FormatInt(int64(age/time.Second), 10))
+	} else {
+		w.Header().Set("Cache-Control", visibility+", no-cache")
+	}
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !matchETag(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil || modified.After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+	// The renderers set it on the 200 responses, a 304 must carry the same Vary
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
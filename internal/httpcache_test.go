@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/apikey"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchETag(t *testing.T) {
+	etag := `W/"abc"`
+	for header, want := range map[string]bool{
+		`W/"abc"`:            true,
+		`"abc"`:              true,
+		`"xyz", W/"abc"`:     true,
+		`*`:                  true,
+		`"xyz"`:              false,
+		`W/"abcd"`:           false,
+		`"xyz",  "abc" `:     true,
+		`W/"ab", W/"c", "d"`: false,
+	} {
+		assert.Equal(t, want, matchETag(header, etag), header)
+	}
+}
+
+func TestSetCacheHeaders(t *testing.T) {
+	app := newTestApp(t)
+	fetched := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	result := cache.Result{Query: cache.Query{Location: "barcelona", Sort: DefaultSort}, Users: newUsers("alice"), TotalCount: 1, FetchedAt: fetched}
+	assert.NoError(t, app.results.PutResult(context.Background(), time.Minute, result))
+	etag := `W/"abc"`
+
+	for _, tc := range []struct {
+		name        string
+		header      string
+		value       string
+		notModified bool
+	}{
+		{"no preconditions", "", "", false},
+		{"matching etag", "If-None-Match", `W/"abc"`, true},
+		{"other etag", "If-None-Match", `W/"xyz"`, false},
+		{"not modified since", "If-Modified-Since", fetched.Add(time.Hour).Format(http.TimeFormat), true},
+		{"same second", "If-Modified-Since", fetched.Format(http.TimeFormat), true},
+		{"modified since", "If-Modified-Since", fetched.Add(-time.Hour).Format(http.TimeFormat), false},
+		{"bad date", "If-Modified-Since", "yesterday", false},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/top/barcelona", nil)
+		if tc.header != "" {
+			r.Header.Set(tc.header, tc.value)
+		}
+		assert.Equal(t, tc.notModified, app.setCacheHeaders(w, r, result, etag), tc.name)
+		assert.Equal(t, etag, w.Header().Get("ETag"), tc.name)
+		assert.Equal(t, fetched.Format(http.TimeFormat), w.Header().Get("Last-Modified"), tc.name)
+		assert.Regexp(t, `^public, max-age=(59|60)$`, w.Header().Get("Cache-Control"), tc.name)
+		if tc.notModified {
+			assert.Equal(t, http.StatusNotModified, w.Code, tc.name)
+			assert.Equal(t, "Accept", w.Header().Get("Vary"), tc.name)
+		}
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/top/barcelona", nil)
+	r.Header.Set("If-None-Match", `W/"xyz"`)
+	r.Header.Set("If-Modified-Since", fetched.Add(time.Hour).Format(http.TimeFormat))
+	assert.False(t, app.setCacheHeaders(w, r, result, etag))
+
+	// A result that is not cached must be revalidated
+	w = httptest.NewRecorder()
+	result.Query.Location = "madrid"
+	app.setCacheHeaders(w, httptest.NewRequest("GET", "/top/madrid", nil), result, etag)
+	assert.Equal(t, "public, no-cache", w.Header().Get("Cache-Control"))
+}
+
+func TestSetCacheHeadersPrivate(t *testing.T) {
+	app := newTestApp(t)
+	app.EnableAPIKeys(apikey.NewCacheStore(app.cache, app.keys), apikey.Quota{})
+	result := cache.Result{Query: cache.Query{Location: "barcelona", Sort: DefaultSort}, FetchedAt: time.Now()}
+	assert.NoError(t, app.results.PutResult(context.Background(), time.Minute, result))
+
+	w := httptest.NewRecorder()
+	app.setCacheHeaders(w, httptest.NewRequest("GET", "/top/barcelona", nil), result, `W/"abc"`)
+	assert.Regexp(t, `^private, max-age=`, w.Header().Get("Cache-Control"))
+}
+
+func TestTopContributorsNotModified(t *testing.T) {
+	app := newTestApp(t)
+	putResults(t, app, "barcelona")
+
+	w := getTop(&app, "barcelona", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+	r := httptest.NewRequest("GET", "/top/barcelona", nil)
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	app.topContributorsHandler(w, mux.SetURLVars(r, map[string]string{"location": "barcelona"}))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, []string{"Accept"}, w.Header()["Vary"])
+	assert.Empty(t, w.Body.String())
+}
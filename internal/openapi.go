@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//APIVersion is the version of the API in the OpenAPI document
+const APIVersion = "1.0.0"
+
+//schemaOf returns the JSON schema of a type from its json tags
+func schemaOf(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Anonymous {
+				for name, p := range schemaOf(f.Type)["properties"].(map[string]interface{}) {
+					properties[name] = p
+				}
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			properties[name] = schemaOf(f.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	return map[string]interface{}{}
+}
+
+//ref returns a reference to a schema of the document
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+//param returns a parameter of an operation
+func param(name string, in string, schema string, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          in,
+		"required":    in == "path",
+		"description": description,
+		"schema":      map[string]interface{}{"type": schema},
+	}
+}
+
+//response returns a response of an operation, a empty schema means no body
+func response(description string, schema map[string]interface{}) map[string]interface{} {
+	r := map[string]interface{}{"description": description}
+	if schema != nil {
+		r["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+	}
+	return r
+}
+
+//openAPI generates the OpenAPI 3 document of the enabled endpoints
+func (app App) openAPI() map[string]interface{} {
+	envelope := schemaOf(reflect.TypeOf(envelopeV1{}))
+	envelope["properties"].(map[string]interface{})["users"] = map[string]interface{}{"type": "array", "items": ref("User")}
+	schemas := map[string]interface{}{
+		"Users":      envelope,
+		"User":       schemaOf(reflect.TypeOf(userV1{})),
+		"CacheEntry": schemaOf(reflect.TypeOf(cacheEntry{})),
+		"RateLimit":  schemaOf(reflect.TypeOf(rateLimitStatus{})),
+	}
+
+	location := param("location", "path", "string", "Location of the users, case and spaces are normalized")
+	top := map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary": "Top Github users of a location ranked by public repositories",
+			"parameters": []interface{}{
+				location,
+				param("items", "query", "integer", "Number of users, at most 100"),
+				param("partial", "query", "boolean", "Return the users fetched when the details of some users fail"),
+				param("format", "query", "string", "Output format: json, csv, ndjson or markdown, it can also be negotiated with the Accept header"),
+				param("fields", "query", "string", "Comma separated fields of the users, also the columns of the csv and markdown formats"),
+			},
+			"responses": map[string]interface{}{
+				"200": response("Ranked users", ref("Users")),
+				"304": response("Not modified since the ETag or date of the preconditions", nil),
+				"400": response("Invalid format or fields", nil),
+				"429": response("Rate limit or quota exceeded", nil),
+				"500": response("Github or cache error", nil),
+			},
+		},
+	}
+	svg := map[string]interface{}{"description": "SVG image", "content": map[string]interface{}{"image/svg+xml": map[string]interface{}{}}}
+	style := []interface{}{
+		param("theme", "query", "string", "Colors: light, dark or blue"),
+		param("size", "query", "string", "Font size: small, medium or large"),
+	}
+	paths := map[string]interface{}{
+		"/v1/top/{location}": top,
+		"/v1/badge/{location}/{login}.svg": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "Badge with the rank of a user in a location",
+				"parameters": append([]interface{}{location, param("login", "path", "string", "Github login"), param("label", "query", "string", "Label of the badge, the location by default"), param("items", "query", "integer", "Number of users the user is ranked in, 25 by default and at most 100")}, style...),
+				"responses":  map[string]interface{}{"200": svg},
+			},
+		},
+		"/v1/ratelimit": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "Github rate limits remaining for the service",
+				"parameters": []interface{}{param("items", "query", "integer", "Forecast if a search of this many users fits in the remaining rate limits")},
+				"responses":  map[string]interface{}{"200": response("Core and search rate limits", ref("RateLimit")), "400": response("Invalid items", nil)},
+			},
+		},
+		"/v1/card/{location}.svg": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "Leaderboard card of a location",
+				"parameters": append([]interface{}{location, param("items", "query", "integer", "Number of users, at most 25")}, style...),
+				"responses":  map[string]interface{}{"200": svg},
+			},
+		},
+	}
+	components := map[string]interface{}{"schemas": schemas}
+	securitySchemes := map[string]interface{}{}
+
+	if app.apiKeys != nil {
+		securitySchemes["apiKey"] = map[string]interface{}{"type": "apiKey", "in": "header", "name": APIKeyHeader}
+		for _, path := range []string{"/v1/top/{location}", "/v1/ratelimit"} {
+			paths[path].(map[string]interface{})["get"].(map[string]interface{})["security"] = []interface{}{map[string]interface{}{"apiKey": []string{}}}
+		}
+	}
+	if app.adminToken != "" {
+		securitySchemes["adminToken"] = map[string]interface{}{"type": "http", "scheme": "bearer"}
+		security := []interface{}{map[string]interface{}{"adminToken": []string{}}}
+		entries := map[string]interface{}{"type": "array", "items": ref("CacheEntry")}
+		prefix := param("prefix", "query", "string", "Location prefix of the entries")
+		paths["/v1/admin/cache"] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "List the cached locations",
+				"security":   security,
+				"parameters": []interface{}{prefix},
+				"responses":  map[string]interface{}{"200": response("Cached locations", entries)},
+			},
+			"delete": map[string]interface{}{
+				"summary":    "Delete the cached locations starting with a prefix",
+				"security":   security,
+				"parameters": []interface{}{prefix},
+				"responses":  map[string]interface{}{"200": response("Number of deleted entries", nil)},
+			},
+		}
+		paths["/v1/admin/cache/{location}"] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "Get a cached location with its users",
+				"security":   security,
+				"parameters": []interface{}{location},
+				"responses":  map[string]interface{}{"200": response("Cached location", ref("CacheEntry")), "404": response("Location not cached", nil)},
+			},
+			"delete": map[string]interface{}{
+				"summary":    "Delete a cached location",
+				"security":   security,
+				"parameters": []interface{}{location},
+				"responses":  map[string]interface{}{"204": response("Deleted", nil)},
+			},
+		}
+		paths["/v1/admin/cache/{location}/refresh"] = map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":    "Fetch a location from Github and replace its cached users",
+				"security":   security,
+				"parameters": []interface{}{location},
+				"responses":  map[string]interface{}{"200": response("Refreshed location", ref("CacheEntry"))},
+			},
+		}
+		id := param("id", "path", "string", "Id of the API key")
+		paths["/v1/admin/keys"] = map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":  "Create an API key stored in the cache",
+				"security": security,
+				"requestBody": map[string]interface{}{
+					"content": map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(newKeyRequest{}))}},
+				},
+				"responses": map[string]interface{}{"201": response("API key, it is only returned once", schemaOf(reflect.TypeOf(newKeyResponse{})))},
+			},
+		}
+		paths["/v1/admin/keys/{id}"] = map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":    "Get an API key stored in the cache",
+				"security":   security,
+				"parameters": []interface{}{id},
+				"responses":  map[string]interface{}{"200": response("API key", nil), "404": response("Unknown API key", nil)},
+			},
+			"delete": map[string]interface{}{
+				"summary":    "Revoke an API key stored in the cache",
+				"security":   security,
+				"parameters": []interface{}{id},
+				"responses":  map[string]interface{}{"204": response("Revoked", nil)},
+			},
+		}
+	}
+	if len(securitySchemes) > 0 {
+		components["securitySchemes"] = securitySchemes
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "ghcontrib",
+			"description": "Top Github contributors by location",
+			"version":     APIVersion,
+		},
+		"paths":      paths,
+		"components": components,
+	}
+}
+
+//openAPIHandler serves the OpenAPI document
+func (app *App) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app.openAPI())
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/apikey"
+	"github.com/stretchr/testify/assert"
+)
+
+//openAPIDocument is the part of the OpenAPI document checked by the tests
+type openAPIDocument struct {
+	OpenAPI    string                                       `json:"openapi"`
+	Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+	Components struct {
+		Schemas         map[string]interface{} `json:"schemas"`
+		SecuritySchemes map[string]interface{} `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+//getOpenAPI requests the OpenAPI document to the router of the app
+func getOpenAPI(t *testing.T, app App) openAPIDocument {
+	w := httptest.NewRecorder()
+	app.router().ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var doc openAPIDocument
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	return doc
+}
+
+//pathNames returns the sorted paths of a document
+func (doc openAPIDocument) pathNames() []string {
+	names := make([]string, 0, len(doc.Paths))
+	for name := range doc.Paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//securedPaths returns the sorted paths whose operations require a security scheme
+func (doc openAPIDocument) securedPaths(scheme string) []string {
+	var names []string
+	for _, name := range doc.pathNames() {
+		for _, op := range doc.Paths[name] {
+			if strings.Contains(mustJSON(op["security"]), `"`+scheme+`"`) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func mustJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+var adminPaths = []string{"/v1/admin/cache", "/v1/admin/cache/{location}", "/v1/admin/cache/{location}/refresh", "/v1/admin/keys", "/v1/admin/keys/{id}"}
+
+var publicPaths = []string{"/v1/badge/{location}/{login}.svg", "/v1/card/{location}.svg", "/v1/ratelimit", "/v1/top/{location}"}
+
+func TestOpenAPIDocument(t *testing.T) {
+	app := newTestApp(t)
+	doc := getOpenAPI(t, app)
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Equal(t, publicPaths, doc.pathNames())
+	assert.Empty(t, doc.Components.SecuritySchemes)
+	assert.Empty(t, doc.securedPaths("apiKey"))
+	for _, name := range []string{"Users", "User", "CacheEntry", "RateLimit"} {
+		assert.Contains(t, doc.Components.Schemas, name)
+	}
+}
+
+func TestOpenAPIDocumentSecurity(t *testing.T) {
+	app := newTestApp(t)
+	quota, err := apikey.NewQuota(app.cache, app.keys, time.Minute, 100)
+	assert.NoError(t, err)
+	app.EnableAPIKeys(apikey.NewCacheStore(app.cache, app.keys), quota)
+	app.EnableAdmin("secret")
+	doc := getOpenAPI(t, app)
+
+	assert.Equal(t, append(append([]string{}, adminPaths...), publicPaths...), doc.pathNames())
+	assert.Equal(t, map[string]interface{}{
+		"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": APIKeyHeader},
+		"adminToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+	}, doc.Components.SecuritySchemes)
+	// The badges are embedded as images, they can not send the API key
+	assert.Equal(t, []string{"/v1/ratelimit", "/v1/top/{location}"}, doc.securedPaths("apiKey"))
+	assert.Equal(t, adminPaths, doc.securedPaths("adminToken"))
+}
+
+func TestOpenAPIPathsAreRouted(t *testing.T) {
+	app := newTestApp(t)
+	app.EnableAdmin("secret")
+	r := app.router()
+	params := strings.NewReplacer("{location}", "barcelona", "{login}", "octocat", "{id}", "abc")
+	doc := getOpenAPI(t, app)
+	for _, name := range doc.pathNames() {
+		for method := range doc.Paths[name] {
+			path := params.Replace(name)
+			for _, route := range []string{path, strings.TrimPrefix(path, "/v1")} {
+				var match mux.RouteMatch
+				assert.True(t, r.Match(httptest.NewRequest(strings.ToUpper(method), route, nil), &match), method+" "+route)
+				assert.Nil(t, match.MatchErr, method+" "+route)
+			}
+		}
+	}
+}
+
+func TestLegacyAndV1Routes(t *testing.T) {
+	app := newTestApp(t)
+	putResults(t, app, "barcelona")
+	r := app.router()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", MediaTypeV1)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	legacy, v1 := get("/top/barcelona"), get("/v1/top/barcelona")
+	assert.Equal(t, http.StatusOK, v1.Code)
+	assert.Equal(t, v1.Code, legacy.Code)
+	assert.Equal(t, MediaTypeV1, v1.Header().Get("Content-Type"))
+	assert.Equal(t, v1.Header(), legacy.Header())
+	assert.Equal(t, v1.Body.String(), legacy.Body.String())
+
+	w := get("/unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "/openapi.json")
+}
+
+func TestExplorer(t *testing.T) {
+	app := newTestApp(t)
+	w := httptest.NewRecorder()
+	app.router().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "openapi.json")
+}
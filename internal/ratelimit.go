@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+)
+
+//EnableRateLimit limits the requests of every client with requests,
+//and the cache misses, that cost Github requests, with misses. A nil Limiter disables its limit
+//With trustProxy the client address is the one appended by the proxy to the X-Forwarded-For header
+func (app *App) EnableRateLimit(requests ratelimit.Limiter, misses ratelimit.Limiter, trustProxy bool) {
+	app.requestLimiter = requests
+	app.missLimiter = misses
+	app.trustProxy = trustProxy
+}
+
+//clientID returns the API key name of a request, or its address for anonymous requests
+//The client writes the leftmost X-Forwarded-For entries, only the rightmost one, appended by the proxy, is trusted
+func (app App) clientID(r *http.Request) string {
+	if k, ok := requestKey(r.Context()); ok {
+		return "key:" + k.Name
+	}
+	if app.trustProxy {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if addr := strings.TrimSpace(entries[len(entries)-1]); addr != "" {
+				return "ip:" + addr
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+//allow takes a token of the client of a request from a Limiter
+//It writes the 429 response if the client is out of tokens, if the Limiter is not available the request is allowed
+func (app App) allow(w http.ResponseWriter, r *http.Request, l ratelimit.Limiter, msg string) bool {
+	if l == nil {
+		return true
+	}
+	client := app.clientID(r)
+	d, err := l.Allow(r.Context(), client)
+	if err != nil {
+		logrus.WithField("client", client).Debug("Error checking client rate limit")
+		logrus.Error(err)
+		return true
+	}
+	if !d.Allowed {
+		logrus.WithField("client", client).Info("Client " + msg)
+		retry := int64(d.RetryAfter/time.Second) + 1
+		w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+		http.Error(w, msg, http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+//rateLimit is a middleware that limits the requests of every client
+func (app App) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.allow(w, r, app.requestLimiter, "rate limit exceeded") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
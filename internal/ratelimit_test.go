@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIDTrustsTheProxyEntry(t *testing.T) {
+	app := App{trustProxy: true}
+	r := httptest.NewRequest("GET", "/v1/top/barcelona", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	assert.Equal(t, "ip:203.0.113.7", app.clientID(r))
+
+	// Values sent by the client can not change the bucket
+	for _, spoofed := range []string{"1.1.1.1, 203.0.113.7", "2.2.2.2,203.0.113.7", "3.3.3.3 , 203.0.113.7"} {
+		r.Header.Set("X-Forwarded-For", spoofed)
+		assert.Equal(t, "ip:203.0.113.7", app.clientID(r))
+	}
+	r.Header.Set("X-Forwarded-For", "4.4.4.4")
+	r.Header.Add("X-Forwarded-For", "203.0.113.7")
+	assert.Equal(t, "ip:203.0.113.7", app.clientID(r))
+}
+
+func TestClientIDWithoutProxy(t *testing.T) {
+	app := App{}
+	r := httptest.NewRequest("GET", "/v1/top/barcelona", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	assert.Equal(t, "ip:10.0.0.1", app.clientID(r))
+}
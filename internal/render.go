@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+//Formats are the output formats of the list endpoints, selected with the format parameter
+//or the Accept header
+var Formats = map[string]string{
+	"json":     "application/json",
+	"csv":      "text/csv; charset=utf-8",
+	"ndjson":   "application/x-ndjson",
+	"markdown": "text/markdown; charset=utf-8",
+}
+
+//mediaFormats maps the media types of the Accept header to the formats
+var mediaFormats = map[string]string{
+	"application/json":     "json",
+	MediaTypeV1:            "json",
+	"text/csv":             "csv",
+	"application/x-ndjson": "ndjson",
+	"application/ndjson":   "ndjson",
+	"text/markdown":        "markdown",
+	"*/*":                  "json",
+	"application/*":        "json",
+}
+
+//column is a field of the items of a list in the tabular formats
+type column struct {
+	name  string
+	value func(item interface{}) string
+}
+
+//columnSet are the columns available for a list and the ones rendered by default
+type columnSet struct {
+	all      []column
+	defaults []string
+}
+
+//userColumns are the columns of the users lists
+var userColumns = columnSet{
+	all: []column{
+		{"login", func(i interface{}) string { return i.(*github.User).GetLogin() }},
+		{"name", func(i interface{}) string { return i.(*github.User).GetName() }},
+		{"location", func(i interface{}) string { return i.(*github.User).GetLocation() }},
+		{"company", func(i interface{}) string { return i.(*github.User).GetCompany() }},
+		{"public_repos", func(i interface{}) string { return strconv.Itoa(i.(*github.User).GetPublicRepos()) }},
+		{"followers", func(i interface{}) string { return strconv.Itoa(i.(*github.User).GetFollowers()) }},
+		{"html_url", func(i interface{}) string { return i.(*github.User).GetHTMLURL() }},
+	},
+	defaults: []string{"login", "name", "public_repos", "html_url"},
+}
+
+//cacheEntryColumns are the columns of the cached locations lists
+var cacheEntryColumns = columnSet{
+	all: []column{
+		{"key", func(i interface{}) string { return i.(cacheEntry).Key }},
+		{"location", func(i interface{}) string { return i.(cacheEntry).Location }},
+		{"sort", func(i interface{}) string { return i.(cacheEntry).Sort }},
+		{"ttl_seconds", func(i interface{}) string { return strconv.FormatInt(i.(cacheEntry).TTLSeconds, 10) }},
+		{"items", func(i interface{}) string { return strconv.Itoa(i.(cacheEntry).Items) }},
+		{"total_count", func(i interface{}) string { return strconv.Itoa(i.(cacheEntry).TotalCount) }},
+		{"empty", func(i interface{}) string { return strconv.FormatBool(i.(cacheEntry).Empty) }},
+		{"fetched_at", func(i interface{}) string { return i.(cacheEntry).FetchedAt.Format(time.RFC3339) }},
+	},
+	defaults: []string{"location", "ttl_seconds", "items", "total_count", "empty", "fetched_at"},
+}
+
+//renderer writes a list in the format negotiated with the client
+type renderer struct {
+	format string
+	// media is the media type of the Accept header the format was negotiated from
+	media   string
+	columns []column
+	// selected is set when the client selected the columns
+	selected bool
+}
+
+//newRenderer negotiates the format of a request and selects the columns of the columns or fields parameter
+//It returns the status code to reply when the format or the columns are not valid
+func newRenderer(r *http.Request, set columnSet) (renderer, int, error) {
+	rd := renderer{format: "json"}
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := Formats[format]; !ok {
+			return rd, http.StatusBadRequest, fmt.Errorf("unknown format %q, valid formats are json, csv, ndjson, markdown", format)
+		}
+		rd.format = format
+	} else if accept := r.Header.Get("Accept"); accept != "" {
+		format, media, ok := negotiate(accept)
+		if !ok {
+			return rd, http.StatusNotAcceptable, fmt.Errorf("no acceptable format, valid types are application/json, text/csv, application/x-ndjson, text/markdown")
+		}
+		rd.format, rd.media = format, media
+	}
+
+	names := set.defaults
+	param := r.URL.Query().Get("columns")
+	if param == "" {
+		param = r.URL.Query().Get("fields")
+	}
+	if param != "" {
+		names = strings.Split(param, ",")
+		rd.selected = true
+	}
+	for _, name := range names {
+		col, ok := set.column(strings.TrimSpace(name))
+		if !ok {
+			return rd, http.StatusBadRequest, fmt.Errorf("unknown column %q", name)
+		}
+		rd.columns = append(rd.columns, col)
+	}
+	return rd, http.StatusOK, nil
+}
+
+//column returns the column with a name
+func (s columnSet) column(name string) (column, bool) {
+	for _, col := range s.all {
+		if col.name == name {
+			return col, true
+		}
+	}
+	return column{}, false
+}
+
+//negotiate returns the preferred media type of an Accept header and its format
+func negotiate(accept string) (string, string, bool) {
+	format, media, best := "", "", -1.0
+	for _, m := range parseAccept(accept) {
+		if f, ok := mediaFormats[m.media]; ok && m.q > 0 && m.q > best {
+			format, media, best = f, m.media, m.q
+		}
+	}
+	return format, media, format != ""
+}
+
+//mediaRange is a media type of an Accept header with its quality
+type mediaRange struct {
+	media string
+	q     float64
+}
+
+//parseAccept returns the media types of an Accept header in their order
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		m := mediaRange{media: strings.ToLower(strings.TrimSpace(params[0])), q: 1.0}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					m.q = v
+				}
+			}
+		}
+		ranges = append(ranges, m)
+	}
+	return ranges
+}
+
+//render writes the items of a list in a response, body is the JSON document and it defaults to the items
+func (rd renderer) render(w http.ResponseWriter, items []interface{}, body interface{}) {
+	w.Header().Set("Content-Type", Formats[rd.format])
+	w.Header().Add("Vary", "Accept")
+	rd.write(w, items, body)
+}
+
+//write writes the items of a list in the format of the renderer
+func (rd renderer) write(w io.Writer, items []interface{}, body interface{}) {
+	switch rd.format {
+	case "csv":
+		rd.renderCSV(w, items)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, item := range items {
+			enc.Encode(item)
+		}
+	case "markdown":
+		rd.renderMarkdown(w, items)
+	case "table":
+		rd.renderTable(w, items)
+	default:
+		if body == nil {
+			body = items
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+//header returns the names of the selected columns
+func (rd renderer) header() []string {
+	names := make([]string, len(rd.columns))
+	for i, col := range rd.columns {
+		names[i] = col.name
+	}
+	return names
+}
+
+//row returns the values of the selected columns of an item
+func (rd renderer) row(item interface{}) []string {
+	values := make([]string, len(rd.columns))
+	for i, col := range rd.columns {
+		values[i] = col.value(item)
+	}
+	return values
+}
+
+func (rd renderer) renderCSV(w io.Writer, items []interface{}) {
+	cw := csv.NewWriter(w)
+	cw.Write(rd.header())
+	for _, item := range items {
+		values := rd.row(item)
+		for i, v := range values {
+			values[i] = csvCell(v)
+		}
+		cw.Write(values)
+	}
+	cw.Flush()
+}
+
+//csvCell neutralizes the values that spreadsheets would run as formulas, the Github profiles are user controlled
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+//markdownEscaper escapes the values that would break a table cell
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ")
+
+func (rd renderer) renderMarkdown(w io.Writer, items []interface{}) {
+	header := rd.header()
+	fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(header)))
+	for _, item := range items {
+		values := rd.row(item)
+		for i, v := range values {
+			values[i] = markdownEscaper.Replace(v)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(values, " | "))
+	}
+}
+
+//renderTable writes the items aligned in columns for terminals
+func (rd renderer) renderTable(w io.Writer, items []interface{}) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(rd.header(), "\t")))
+	for _, item := range items {
+		fmt.Fprintln(tw, strings.Join(rd.row(item), "\t"))
+	}
+	tw.Flush()
+}
+
+//userItems returns the users as the items of a list
+func userItems(users []*github.User) []interface{} {
+	items := make([]interface{}, len(users))
+	for i, u := range users {
+		items[i] = u
+	}
+	return items
+}
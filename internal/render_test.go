@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	for accept, want := range map[string]string{
+		"text/csv":                             "csv",
+		"application/json":                     "json",
+		"text/markdown;q=0.5, text/csv;q=0.9":  "csv",
+		"application/x-ndjson, text/csv;q=0.1": "ndjson",
+		"*/*":                                  "json",
+		"TEXT/CSV":                             "csv",
+		"text/csv;q=0, application/json;q=0.2": "json",
+		MediaTypeV1:                            "json",
+	} {
+		format, _, ok := negotiate(accept)
+		assert.True(t, ok, accept)
+		assert.Equal(t, want, format, accept)
+	}
+	_, media, _ := negotiate("application/json;q=0.5, " + MediaTypeV1)
+	assert.Equal(t, MediaTypeV1, media)
+	for _, accept := range []string{"text/*", "text/html", "image/png", "text/csv;q=0"} {
+		_, _, ok := negotiate(accept)
+		assert.False(t, ok, accept)
+	}
+}
+
+func TestNewRendererColumns(t *testing.T) {
+	rd, _, err := newRenderer(httptest.NewRequest("GET", "/top/barcelona", nil), userColumns)
+	assert.NoError(t, err)
+	assert.Equal(t, userColumns.defaults, rd.header())
+	assert.False(t, rd.selected)
+
+	rd, _, err = newRenderer(httptest.NewRequest("GET", "/top/barcelona?format=csv&columns=login,%20followers", nil), userColumns)
+	assert.NoError(t, err)
+	assert.Equal(t, "csv", rd.format)
+	assert.Equal(t, []string{"login", "followers"}, rd.header())
+	assert.True(t, rd.selected)
+
+	_, status, err := newRenderer(httptest.NewRequest("GET", "/top/barcelona?columns=login,email", nil), userColumns)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	_, status, err = newRenderer(httptest.NewRequest("GET", "/top/barcelona?format=xml", nil), userColumns)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	r := httptest.NewRequest("GET", "/top/barcelona", nil)
+	r.Header.Set("Accept", "text/html")
+	_, status, err = newRenderer(r, userColumns)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotAcceptable, status)
+}
+
+// tabularUsers are users with values that break the tabular formats
+var tabularUsers = []interface{}{
+	&github.User{Login: github.String("octocat"), Name: github.String("Octo | Cat"), PublicRepos: github.Int(8)},
+	&github.User{Login: github.String("mallory"), Name: github.String("=HYPERLINK(\"http://evil\")\nx"), PublicRepos: github.Int(1)},
+}
+
+func tabularRenderer(t *testing.T, format string) renderer {
+	rd, _, err := newRenderer(httptest.NewRequest("GET", "/top/barcelona?format="+format+"&columns=login,name,public_repos", nil), userColumns)
+	assert.NoError(t, err)
+	return rd
+}
+
+func TestRenderCSV(t *testing.T) {
+	var b bytes.Buffer
+	tabularRenderer(t, "csv").write(&b, tabularUsers, nil)
+	assert.Equal(t, "login,name,public_repos\noctocat,Octo | Cat,8\nmallory,\"'=HYPERLINK(\"\"http://evil\"\")\nx\",1\n", b.String())
+
+	for value, want := range map[string]string{"+1": "'+1", "-1": "'-1", "@SUM(A1)": "'@SUM(A1)", "\tx": "'\tx", "a=b": "a=b", "": ""} {
+		assert.Equal(t, want, csvCell(value), value)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	var b bytes.Buffer
+	tabularRenderer(t, "markdown").write(&b, tabularUsers, nil)
+	assert.Equal(t, "| login | name | public_repos |\n| --- | --- | --- |\n| octocat | Octo \\| Cat | 8 |\n| mallory | =HYPERLINK(\"http://evil\") x | 1 |\n", b.String())
+}
+
+func TestRenderTable(t *testing.T) {
+	rd := tabularRenderer(t, "csv")
+	rd.format = "table"
+	var b bytes.Buffer
+	rd.write(&b, tabularUsers[:1], nil)
+	assert.Equal(t, "LOGIN    NAME        PUBLIC_REPOS\noctocat  Octo | Cat  8\n", b.String())
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+)
+
+//SchemaV1 is the version of the users response schema
+//Fields can be added to a version, removing or changing them requires a new version
+const SchemaV1 = 1
+
+//MediaTypeV1 is the media type that requests the v1 schema
+const MediaTypeV1 = "application/vnd.ghcontrib.v1+json"
+
+//userV1 is a ranked user in the v1 schema
+type userV1 struct {
+	Rank        int    `json:"rank"`
+	Login       string `json:"login"`
+	Name        string `json:"name"`
+	AvatarURL   string `json:"avatar_url"`
+	HTMLURL     string `json:"html_url"`
+	PublicRepos int    `json:"public_repos"`
+	Followers   int    `json:"followers"`
+	// Score is the value the users are ranked by
+	Score    float64 `json:"score"`
+	Location string  `json:"location"`
+}
+
+//envelopeV1 is the users response in the v1 schema
+type envelopeV1 struct {
+	Version   int       `json:"version"`
+	Location  string    `json:"location"`
+	Items     int       `json:"items"`
+	Cached    bool      `json:"cached"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Partial   bool      `json:"partial"`
+	Failed    []string  `json:"failed,omitempty"`
+	// Empty is only set when the location has no users
+	Empty bool          `json:"empty"`
+	Users []interface{} `json:"users"`
+}
+
+//userV1Fields are the fields of the v1 users in their order, they are the fields and columns accepted
+var userV1Fields = []struct {
+	name  string
+	value func(u userV1) interface{}
+}{
+	{"rank", func(u userV1) interface{} { return u.Rank }},
+	{"login", func(u userV1) interface{} { return u.Login }},
+	{"name", func(u userV1) interface{} { return u.Name }},
+	{"avatar_url", func(u userV1) interface{} { return u.AvatarURL }},
+	{"html_url", func(u userV1) interface{} { return u.HTMLURL }},
+	{"public_repos", func(u userV1) interface{} { return u.PublicRepos }},
+	{"followers", func(u userV1) interface{} { return u.Followers }},
+	{"score", func(u userV1) interface{} { return u.Score }},
+	{"location", func(u userV1) interface{} { return u.Location }},
+}
+
+//userV1Columns are the columns of the v1 users lists
+var userV1Columns = func() columnSet {
+	set := columnSet{defaults: []string{"rank", "login", "name", "public_repos", "followers", "html_url"}}
+	for _, f := range userV1Fields {
+		value := f.value
+		set.all = append(set.all, column{f.name, func(i interface{}) string {
+			switch v := value(i.(userV1)).(type) {
+			case string:
+				return v
+			case int:
+				return strconv.Itoa(v)
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			return ""
+		}})
+	}
+	return set
+}()
+
+//wantsV1 checks if a request asks for the v1 schema with the v parameter or the Accept header
+func wantsV1(r *http.Request) bool {
+	if r.URL.Query().Get("v") == strconv.Itoa(SchemaV1) {
+		return true
+	}
+	for _, m := range parseAccept(r.Header.Get("Accept")) {
+		if m.media == MediaTypeV1 && m.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//newUserV1 returns the v1 user of a github user ranked in a sort
+func newUserV1(rank int, u *github.User, sort string) userV1 {
+	return userV1{
+		Rank:        rank,
+		Login:       u.GetLogin(),
+		Name:        u.GetName(),
+		AvatarURL:   u.GetAvatarURL(),
+		HTMLURL:     u.GetHTMLURL(),
+		PublicRepos: u.GetPublicRepos(),
+		Followers:   u.GetFollowers(),
+		Score:       score(u, sort),
+		Location:    u.GetLocation(),
+	}
+}
+
+//sparse returns the fields of a v1 user selected by a renderer
+func (rd renderer) sparse(u userV1) map[string]interface{} {
+	fields := make(map[string]interface{}, len(rd.columns))
+	for _, f := range userV1Fields {
+		for _, col := range rd.columns {
+			if col.name == f.name {
+				fields[f.name] = f.value(u)
+			}
+		}
+	}
+	return fields
+}
+
+//RenderUsers writes the users of a result in the v1 schema for the command line
+//The formats are the ones of the API plus table, fields selects the fields or the columns
+func RenderUsers(w io.Writer, format string, fields []string, result cache.Result, items int, cached bool) error {
+	if _, ok := Formats[format]; !ok && format != "table" {
+		return fmt.Errorf("unknown format %q, valid formats are table, json, csv, ndjson, markdown", format)
+	}
+	rd := renderer{format: format, selected: len(fields) > 0}
+	if !rd.selected {
+		fields = userV1Columns.defaults
+	}
+	for _, name := range fields {
+		col, ok := userV1Columns.column(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown field %q", name)
+		}
+		rd.columns = append(rd.columns, col)
+	}
+	users := result.Users
+	if len(users) > items {
+		users = users[:items]
+	}
+	rd.writeV1(w, result, users, cached)
+	return nil
+}
+
+//renderV1 writes the users of a result in the v1 schema
+//cached tells if the result was served from the cache, the v1 media type is echoed when the client asked for it
+func (rd renderer) renderV1(w http.ResponseWriter, result cache.Result, users []*github.User, cached bool) {
+	contentType := Formats[rd.format]
+	if rd.media == MediaTypeV1 {
+		contentType = MediaTypeV1
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	rd.writeV1(w, result, users, cached)
+}
+
+//writeV1 writes the users of a result in the v1 schema in the format of the renderer
+func (rd renderer) writeV1(w io.Writer, result cache.Result, users []*github.User, cached bool) {
+	items := make([]interface{}, len(users))
+	for i, u := range users {
+		user := newUserV1(i+1, u, result.Query.Sort)
+		if rd.selected && (rd.format == "json" || rd.format == "ndjson") {
+			items[i] = rd.sparse(user)
+		} else {
+			items[i] = user
+		}
+	}
+	rd.write(w, items, envelopeV1{
+		Version:   SchemaV1,
+		Location:  result.Query.Location,
+		Items:     len(items),
+		Cached:    cached,
+		FetchedAt: result.FetchedAt,
+		Partial:   len(result.Failed) > 0,
+		Failed:    result.Failed,
+		Empty:     result.Empty,
+		Users:     items,
+	})
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/gorilla/mux"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+var octocat = &github.User{
+	Login:       github.String("octocat"),
+	Name:        github.String("The Octocat"),
+	AvatarURL:   github.String("https://avatars.example.com/octocat"),
+	HTMLURL:     github.String("https://github.com/octocat"),
+	PublicRepos: github.Int(8),
+	Followers:   github.Int(3000),
+	Location:    github.String("San Francisco"),
+}
+
+func TestNewUserV1(t *testing.T) {
+	u := newUserV1(2, octocat, "repos")
+	assert.Equal(t, userV1{
+		Rank:        2,
+		Login:       "octocat",
+		Name:        "The Octocat",
+		AvatarURL:   "https://avatars.example.com/octocat",
+		HTMLURL:     "https://github.com/octocat",
+		PublicRepos: 8,
+		Followers:   3000,
+		Score:       8,
+		Location:    "San Francisco",
+	}, u)
+	assert.Equal(t, float64(3000), newUserV1(1, octocat, "followers").Score)
+	assert.Equal(t, "", newUserV1(1, &github.User{}, "repos").Login)
+}
+
+func TestWantsV1(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                                   false,
+		"application/json":                   false,
+		MediaTypeV1:                          true,
+		"text/csv, " + MediaTypeV1:           true,
+		MediaTypeV1 + ";q=0":                 false,
+		MediaTypeV1 + "; q=0.5":              true,
+		"application/vnd.ghcontrib.v10+json": false,
+	} {
+		r := httptest.NewRequest("GET", "/top/barcelona", nil)
+		r.Header.Set("Accept", accept)
+		assert.Equal(t, want, wantsV1(r), accept)
+	}
+	assert.True(t, wantsV1(httptest.NewRequest("GET", "/top/barcelona?v=1", nil)))
+}
+
+func TestV1ContentType(t *testing.T) {
+	app := newTestApp(t)
+	putResults(t, app, "barcelona")
+	r := app.router()
+	for accept, want := range map[string]string{
+		"":                                       "application/json",
+		"application/json":                       "application/json",
+		MediaTypeV1:                              MediaTypeV1,
+		"application/json;q=0.5, " + MediaTypeV1: MediaTypeV1,
+		"text/csv":                               Formats["csv"],
+	} {
+		for _, path := range []string{"/v1/top/barcelona", "/top/barcelona?v=1"} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("Accept", accept)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code, accept)
+			assert.Equal(t, want, w.Header().Get("Content-Type"), accept)
+		}
+	}
+}
+
+func TestV1Fields(t *testing.T) {
+	rd, status, err := newRenderer(httptest.NewRequest("GET", "/v1/top/barcelona?fields=login,score", nil), userV1Columns)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{"login": "octocat", "score": float64(8)}, rd.sparse(newUserV1(1, octocat, "repos")))
+
+	_, status, err = newRenderer(httptest.NewRequest("GET", "/v1/top/barcelona?fields=login,password", nil), userV1Columns)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestWriteV1Envelope(t *testing.T) {
+	fetched := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	result := cache.Result{
+		Query:      cache.Query{Location: "barcelona", Sort: "repos"},
+		Users:      []*github.User{octocat},
+		TotalCount: 2,
+		Failed:     []string{"ghost"},
+		FetchedAt:  fetched,
+	}
+	rd, _, err := newRenderer(httptest.NewRequest("GET", "/v1/top/barcelona?fields=rank,login", nil), userV1Columns)
+	assert.NoError(t, err)
+	var b bytes.Buffer
+	rd.writeV1(&b, result, result.Users, true)
+	assert.JSONEq(t, `{
+		"version": 1,
+		"location": "barcelona",
+		"items": 1,
+		"cached": true,
+		"fetched_at": "2020-12-01T10:00:00Z",
+		"partial": true,
+		"failed": ["ghost"],
+		"empty": false,
+		"users": [{"rank": 1, "login": "octocat"}]
+	}`, b.String())
+}
+
+func TestLoadResultCached(t *testing.T) {
+	app := newTestApp(t)
+	q := cache.Query{Location: "barcelona", Sort: DefaultSort}
+	// The fetch time of another replica might be ahead of this one
+	assert.NoError(t, app.results.PutResult(context.Background(), time.Minute, cache.Result{
+		Query:      q,
+		Users:      []*github.User{octocat},
+		TotalCount: 1,
+		FetchedAt:  time.Now().Add(time.Hour),
+	}))
+	w := httptest.NewRecorder()
+	_, cached, ok := app.loadResult(w, httptest.NewRequest("GET", "/v1/top/barcelona", nil), q, 10, false)
+	assert.True(t, ok)
+	assert.True(t, cached)
+
+	var envelope envelopeV1
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v1/top/barcelona", nil)
+	r = mux.SetURLVars(r, map[string]string{"location": "barcelona"})
+	app.topContributorsV1Handler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+	assert.True(t, envelope.Cached)
+}
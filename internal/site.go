@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/sirupsen/logrus"
+)
+
+//SitePreviewItems is the number of users of every location in the site index
+const SitePreviewItems = 3
+
+//siteTemplates are the pages of the static site
+//go:embed assets/site/*.html
+var siteTemplates embed.FS
+
+//sitePage is a location of the static site
+type sitePage struct {
+	Name      string
+	Slug      string
+	Total     int
+	FetchedAt time.Time
+	Updated   time.Time
+	Users     []userV1
+	Error     string
+}
+
+//Preview returns the first users of a location for the index
+func (p sitePage) Preview() []userV1 {
+	if len(p.Users) > SitePreviewItems {
+		return p.Users[:SitePreviewItems]
+	}
+	return p.Users
+}
+
+//siteIndex is the index of the static site
+type siteIndex struct {
+	Locations []sitePage
+	Updated   time.Time
+}
+
+//siteIndexData is the JSON index of the locations of the static site
+type siteIndexData struct {
+	Updated   time.Time           `json:"updated"`
+	Locations []siteLocationEntry `json:"locations"`
+}
+
+//siteLocationEntry is a location of the JSON index
+type siteLocationEntry struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Data  string `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+var slugInvalid = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+//slug returns the file name of a location, letters and numbers of any script are kept
+func slug(location string) string {
+	return strings.Trim(slugInvalid.ReplaceAllString(cache.NormalizeLocation(location), "-"), "-")
+}
+
+//GenerateSite writes a static site with the ranking of the locations to dir
+//Every location has a page and a JSON data file in the v1 schema, the locations that fail
+//are listed in the index and the error is returned after writing the site
+func (app *App) GenerateSite(ctx context.Context, dir string, locations []string, items int) error {
+	tmpl, err := template.ParseFS(siteTemplates, "assets/site/*.html")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+		return err
+	}
+
+	updated := time.Now().UTC()
+	index := siteIndex{Updated: updated}
+	data := siteIndexData{Updated: updated}
+	var failed []string
+	// slugs are the locations of the generated slugs, a page must not overwrite another one
+	slugs := map[string]string{}
+	for _, location := range locations {
+		page := sitePage{Name: location, Slug: slug(location), Updated: updated}
+		entry := siteLocationEntry{Name: location, Slug: page.Slug}
+		if page.Slug == "" {
+			logrus.WithField("location", location).Error("Invalid location")
+			failed = append(failed, location)
+			continue
+		}
+		if other, ok := slugs[page.Slug]; ok {
+			if cache.NormalizeLocation(other) == cache.NormalizeLocation(location) {
+				logrus.WithField("location", location).Debug("Skipping duplicated location")
+				continue
+			}
+			logrus.WithFields(logrus.Fields{"location": location, "other": other}).Error("Location page collides with another location")
+			failed = append(failed, location)
+			continue
+		}
+		slugs[page.Slug] = location
+		logrus.WithField("location", location).Info("Generating location page")
+		result, cached, err := app.TopUsers(ctx, cache.Query{Location: location}, items)
+		if err != nil {
+			logrus.WithField("location", location).Error(err)
+			page.Error, entry.Error = err.Error(), err.Error()
+			failed = append(failed, location)
+			index.Locations = append(index.Locations, page)
+			data.Locations = append(data.Locations, entry)
+			continue
+		}
+
+		users := result.Users
+		if len(users) > items {
+			users = users[:items]
+		}
+		envelope := envelopeV1{
+			Version:   SchemaV1,
+			Location:  result.Query.Location,
+			Items:     len(users),
+			Cached:    cached,
+			FetchedAt: result.FetchedAt,
+			Partial:   len(result.Failed) > 0,
+			Failed:    result.Failed,
+			Empty:     result.Empty,
+			Users:     make([]interface{}, len(users)),
+		}
+		for i, u := range users {
+			user := newUserV1(i+1, u, result.Query.Sort)
+			page.Users = append(page.Users, user)
+			envelope.Users[i] = user
+		}
+		page.Total = result.TotalCount
+		page.FetchedAt = result.FetchedAt
+		entry.Data = "data/" + page.Slug + ".json"
+
+		if err := writeJSON(filepath.Join(dir, entry.Data), envelope); err != nil {
+			return err
+		}
+		if err := writeTemplate(tmpl, "location.html", filepath.Join(dir, page.Slug+".html"), page); err != nil {
+			return err
+		}
+		index.Locations = append(index.Locations, page)
+		data.Locations = append(data.Locations, entry)
+	}
+
+	if err := writeTemplate(tmpl, "index.html", filepath.Join(dir, "index.html"), index); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(dir, "data", "index.json"), data); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to generate %d locations: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+//writeTemplate renders a template to a file
+func writeTemplate(tmpl *template.Template, name string, path string, data interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.ExecuteTemplate(f, name, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//writeJSON writes a JSON document to a file
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/jpiriz/ghcontrib/pkg/githubclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "san-francisco", slug("  San   Francisco "))
+	assert.Equal(t, "new-york", slug("New York"))
+	assert.Equal(t, "new-york", slug("new-york"))
+	assert.Equal(t, "東京", slug("東京"))
+	assert.Equal(t, "москва", slug("Москва"))
+	assert.Equal(t, "são-paulo", slug("São Paulo"))
+	assert.Equal(t, "", slug("../.."))
+}
+
+func TestGenerateSite(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	fetched := time.Now().UTC().Truncate(time.Second)
+	for _, location := range []string{"barcelona", "東京", "new york"} {
+		assert.NoError(t, app.results.PutResult(ctx, time.Minute, cache.Result{
+			Query:      cache.Query{Location: location, Sort: DefaultSort},
+			Users:      []*github.User{{Login: github.String("octocat"), PublicRepos: github.Int(8)}, {Login: github.String("<hubot>"), PublicRepos: github.Int(3)}},
+			TotalCount: 2,
+			FetchedAt:  fetched,
+		}))
+	}
+
+	dir := t.TempDir()
+	err := app.GenerateSite(ctx, dir, []string{"Barcelona", "東京", "New York", "new  york", "new-york", "!!"}, 10)
+	// new-york collides with New York and !! has no slug, the duplicated new  york is skipped
+	assert.EqualError(t, err, "failed to generate 2 locations: new-york, !!")
+
+	for _, name := range []string{"index.html", "barcelona.html", "東京.html", "new-york.html", "data/index.json", "data/東京.json"} {
+		assert.FileExists(t, filepath.Join(dir, name))
+	}
+	page, err := ioutil.ReadFile(filepath.Join(dir, "barcelona.html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), "&lt;hubot&gt;")
+	assert.NotContains(t, string(page), "<hubot>")
+
+	var envelope envelopeV1
+	data, err := ioutil.ReadFile(filepath.Join(dir, "data", "new-york.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &envelope))
+	assert.Equal(t, "new york", envelope.Location)
+	assert.Equal(t, 2, envelope.Items)
+
+	var index siteIndexData
+	data, err = ioutil.ReadFile(filepath.Join(dir, "data", "index.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &index))
+	assert.Len(t, index.Locations, 3)
+}
+
+func TestGenerateSiteFailedLocation(t *testing.T) {
+	app := newTestApp(t)
+	app.ghClient = &fakeGithub{
+		search: func(q cache.Query, items int, partial bool) (githubclient.SearchResult, error) {
+			return githubclient.SearchResult{}, errors.New("search failed")
+		},
+	}
+	ctx := context.Background()
+	assert.NoError(t, app.results.PutResult(ctx, time.Minute, cache.Result{
+		Query:      cache.Query{Location: "barcelona", Sort: DefaultSort},
+		Users:      newUsers("octocat"),
+		TotalCount: 1,
+		FetchedAt:  time.Now(),
+	}))
+
+	dir := t.TempDir()
+	err := app.GenerateSite(ctx, dir, []string{"Barcelona", "Madrid"}, 10)
+	assert.EqualError(t, err, "failed to generate 1 locations: Madrid")
+	assert.NoFileExists(t, filepath.Join(dir, "madrid.html"))
+
+	// The failed location is listed without a link to its page, that is not written
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(index), `<a href="barcelona.html">Barcelona</a>`)
+	assert.Contains(t, string(index), "<h2>Madrid</h2>")
+	assert.NotContains(t, string(index), "madrid.html")
+}
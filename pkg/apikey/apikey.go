@@ -0,0 +1,151 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+)
+
+//ErrKeyNotFound is returned by a Store when an API key is not valid
+var ErrKeyNotFound = errors.New("api key not found")
+
+//Key is an API key with its quota
+type Key struct {
+	// Name identifies the client, keys with the same name share the quota
+	Name string `json:"name"`
+	// Key is the secret sent by the client, it is only set in the keys file
+	Key string `json:"key,omitempty"`
+	// Quota is the number of requests allowed per window, 0 uses the default quota
+	Quota int64 `json:"quota,omitempty"`
+}
+
+//Store is the interface to look up the API keys
+type Store interface {
+	Lookup(ctx context.Context, token string) (Key, error)
+}
+
+//ID returns the identifier of a token, only the hash of the tokens is stored
+func ID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+//Generate returns a new random token
+func Generate() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+//Stores looks up the API keys in several stores in order
+type Stores []Store
+
+//Lookup returns the key of the first store that has the token
+func (s Stores) Lookup(ctx context.Context, token string) (Key, error) {
+	for _, store := range s {
+		k, err := store.Lookup(ctx, token)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		return k, err
+	}
+	return Key{}, ErrKeyNotFound
+}
+
+//fileStore is the Implementation of Store for the keys of a file
+type fileStore struct {
+	keys map[string]Key
+}
+
+//LoadFile returns a Store with the keys of a JSON file
+//The file is a list of objects with the name, key and quota of every API key
+func LoadFile(path string) (Store, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []Key
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid api keys file %s: %v", path, err)
+	}
+	s := fileStore{keys: make(map[string]Key, len(list))}
+	for i, k := range list {
+		if k.Key == "" || k.Name == "" {
+			return nil, fmt.Errorf("invalid api keys file %s: key %d has no name or key", path, i)
+		}
+		id := ID(k.Key)
+		k.Key = ""
+		s.keys[id] = k
+	}
+	return s, nil
+}
+
+//Lookup returns the key of a token
+func (s fileStore) Lookup(ctx context.Context, token string) (Key, error) {
+	if k, ok := s.keys[ID(token)]; ok {
+		return k, nil
+	}
+	return Key{}, ErrKeyNotFound
+}
+
+//CacheStore is the Implementation of Store on top of a Cache
+//Keys are stored by the hash of the token and never expire
+type CacheStore struct {
+	cache cache.Cache
+	keys  cache.KeyBuilder
+}
+
+//NewCacheStore returns a CacheStore
+func NewCacheStore(c cache.Cache, keys cache.KeyBuilder) CacheStore {
+	return CacheStore{
+		cache: c,
+		keys:  keys,
+	}
+}
+
+//Lookup returns the key of a token
+func (s CacheStore) Lookup(ctx context.Context, token string) (Key, error) {
+	return s.Get(ctx, ID(token))
+}
+
+//Get returns the key with an id
+func (s CacheStore) Get(ctx context.Context, id string) (Key, error) {
+	key := s.keys.APIKey(id)
+	value, err := s.cache.GetKey(ctx, key)
+	if err != nil {
+		if exists, eerr := s.cache.Exists(ctx, key); eerr == nil && exists == 0 {
+			return Key{}, ErrKeyNotFound
+		}
+		return Key{}, err
+	}
+	var k Key
+	if err := json.Unmarshal([]byte(fmt.Sprint(value)), &k); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+//Put stores the key of a token and returns its id
+func (s CacheStore) Put(ctx context.Context, token string, k Key) (string, error) {
+	k.Key = ""
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", err
+	}
+	id := ID(token)
+	return id, s.cache.SetKey(ctx, 0, s.keys.APIKey(id), string(data))
+}
+
+//Delete removes the key with an id
+func (s CacheStore) Delete(ctx context.Context, id string) error {
+	return s.cache.Delete(ctx, s.keys.APIKey(id))
+}
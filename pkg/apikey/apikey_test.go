@@ -0,0 +1,143 @@
+package apikey
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	s    *miniredis.Miniredis
+	c    cache.RedisCache
+	keys cache.KeyBuilder
+	ctx  context.Context
+)
+
+func TestMain(m *testing.M) {
+	s, _ = miniredis.Run()
+	c, _ = cache.NewRedisCache(cache.RedisOptions{Addrs: []string{s.Addr()}, Lock: cache.DefaultLockOptions()})
+	keys = cache.NewKeyBuilder("test")
+	ctx = context.Background()
+	os.Exit(m.Run())
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"name": "ci", "key": "secret", "quota": 10}]`), 0600))
+
+	store, err := LoadFile(path)
+	assert.NoError(t, err)
+	k, err := store.Lookup(ctx, "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, Key{Name: "ci", Quota: 10}, k)
+
+	_, err = store.Lookup(ctx, "other")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"name": "ci"}]`), 0600))
+	_, err := LoadFile(path)
+	assert.Error(t, err)
+}
+
+func TestCacheStore(t *testing.T) {
+	store := NewCacheStore(c, keys)
+	id, err := store.Put(ctx, "token", Key{Name: "dashboard", Key: "token"})
+	assert.NoError(t, err)
+	assert.Equal(t, ID("token"), id)
+	assert.False(t, s.Exists(keys.APIKey("token")))
+
+	k, err := store.Lookup(ctx, "token")
+	assert.NoError(t, err)
+	assert.Equal(t, Key{Name: "dashboard"}, k)
+
+	assert.NoError(t, store.Delete(ctx, id))
+	_, err = store.Lookup(ctx, "token")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestStoresLookupInOrder(t *testing.T) {
+	store := NewCacheStore(c, keys)
+	_, err := store.Put(ctx, "cached", Key{Name: "cached"})
+	assert.NoError(t, err)
+	stores := Stores{fileStore{keys: map[string]Key{ID("file"): {Name: "file"}}}, store}
+
+	k, err := stores.Lookup(ctx, "file")
+	assert.NoError(t, err)
+	assert.Equal(t, "file", k.Name)
+	k, err = stores.Lookup(ctx, "cached")
+	assert.NoError(t, err)
+	assert.Equal(t, "cached", k.Name)
+	_, err = stores.Lookup(ctx, "unknown")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestNewQuotaInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		window time.Duration
+		limit  int64
+	}{{0, 10}, {-time.Minute, 10}, {time.Minute, 0}, {time.Minute, -1}} {
+		_, err := NewQuota(c, keys, tc.window, tc.limit)
+		assert.Error(t, err, "window %s limit %d", tc.window, tc.limit)
+	}
+	_, err := NewQuota(c, keys, time.Minute, 10)
+	assert.NoError(t, err)
+}
+
+func TestQuotaTake(t *testing.T) {
+	q, _ := NewQuota(c, keys, time.Minute, 3)
+	start := time.Unix(1200, 0)
+	q.now = func() time.Time { return start }
+	k := Key{Name: "take"}
+
+	for i := int64(2); i >= 0; i-- {
+		usage, ok, err := q.Take(ctx, k)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, i, usage.Remaining)
+		assert.Equal(t, start.Add(time.Minute), usage.Reset)
+	}
+	usage, ok, err := q.Take(ctx, k)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), usage.Remaining)
+}
+
+func TestQuotaSlidingWindow(t *testing.T) {
+	q, _ := NewQuota(c, keys, time.Minute, 4)
+	start := time.Unix(2400, 0)
+	q.now = func() time.Time { return start }
+	k := Key{Name: "sliding"}
+	for i := 0; i < 4; i++ {
+		_, ok, _ := q.Take(ctx, k)
+		assert.True(t, ok)
+	}
+
+	// Half of the previous window still counts
+	q.now = func() time.Time { return start.Add(90 * time.Second) }
+	for i := 0; i < 2; i++ {
+		_, ok, _ := q.Take(ctx, k)
+		assert.True(t, ok)
+	}
+	_, ok, _ := q.Take(ctx, k)
+	assert.False(t, ok)
+}
+
+func TestQuotaPerKeyLimit(t *testing.T) {
+	q, _ := NewQuota(c, keys, time.Minute, 1)
+	k := Key{Name: "premium", Quota: 2}
+	usage, ok, err := q.Take(ctx, k)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), usage.Limit)
+	assert.Equal(t, int64(1), usage.Remaining)
+}
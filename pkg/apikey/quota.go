@@ -0,0 +1,98 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+)
+
+//Usage is the state of the quota of a key after a request
+type Usage struct {
+	Limit     int64
+	Remaining int64
+	// Reset is the end of the current window
+	Reset time.Time
+}
+
+//Quota limits the requests of every key with a sliding window
+//The requests of the previous window are weighted by the part of it that overlaps the sliding window,
+//so the count is approximated with two counters per key shared by all the replicas
+type Quota struct {
+	cache  cache.Cache
+	keys   cache.KeyBuilder
+	window time.Duration
+	limit  int64
+	now    func() time.Time
+}
+
+//NewQuota returns a Quota of limit requests per window for the keys without their own quota
+//The window and the limit must be positive
+func NewQuota(c cache.Cache, keys cache.KeyBuilder, window time.Duration, limit int64) (Quota, error) {
+	if window <= 0 {
+		return Quota{}, fmt.Errorf("quota window must be positive, got %s", window)
+	}
+	if limit <= 0 {
+		return Quota{}, fmt.Errorf("quota must be positive, got %d", limit)
+	}
+	return Quota{
+		cache:  c,
+		keys:   keys,
+		window: window,
+		limit:  limit,
+		now:    time.Now,
+	}, nil
+}
+
+//counter returns the key of the counter of a key in a window
+func (q Quota) counter(k Key, window int64) string {
+	return q.keys.Counter("quota-"+k.Name, strconv.FormatInt(window, 10))
+}
+
+//count returns the value of a counter, missing counters are 0
+func (q Quota) count(ctx context.Context, key string) int64 {
+	value, err := q.cache.GetKey(ctx, key)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+//Take counts a request of a key, it returns false if the key exceeded its quota
+//Rejected requests are not counted. Concurrent requests might exceed the quota slightly
+func (q Quota) Take(ctx context.Context, k Key) (Usage, bool, error) {
+	limit := k.Quota
+	if limit <= 0 {
+		limit = q.limit
+	}
+	now := q.now()
+	window := now.UnixNano() / int64(q.window)
+	start := time.Unix(0, window*int64(q.window))
+	usage := Usage{Limit: limit, Reset: start.Add(q.window)}
+
+	previous := q.count(ctx, q.counter(k, window-1))
+	current := q.count(ctx, q.counter(k, window))
+	weight := 1 - float64(now.Sub(start))/float64(q.window)
+	used := int64(float64(previous)*weight) + current
+	if used >= limit {
+		return usage, false, nil
+	}
+
+	// Counters live two windows, the current one is the previous window of the next
+	n, err := q.cache.Incr(ctx, 2*q.window, q.counter(k, window))
+	if err != nil {
+		usage.Remaining = limit - used
+		return usage, true, err
+	}
+	usage.Remaining = limit - (used - current + n)
+	if usage.Remaining < 0 {
+		usage.Remaining = 0
+	}
+	return usage, true, nil
+}
@@ -0,0 +1,388 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	//ErrKeyNotFound is returned by BoltCache when a key does not exist or is expired
+	ErrKeyNotFound = errors.New("key not found")
+	//ErrWrongType is returned by BoltCache when a key does not hold the kind of value of an operation
+	ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+)
+
+const (
+	// JanitorInterval is the time between the removals of the expired keys
+	JanitorInterval = time.Minute
+	boltBucket      = "cache"
+)
+
+//boltRecord is the stored representation of a key
+//Values are bytes so the binary codecs survive the JSON encoding of the record
+type boltRecord struct {
+	Value     *[]byte `json:"value,omitempty"`
+	ExpiresAt int64   `json:"expires_at,omitempty"`
+}
+
+//expired checks if the record TTL is over
+func (rec boltRecord) expired(now time.Time) bool {
+	return rec.ExpiresAt > 0 && now.UnixNano() >= rec.ExpiresAt
+}
+
+//BoltCache is the Implementation of Cache interface for a bbolt file
+//It survives restarts without Redis, it is meant for single node deployments
+type BoltCache struct {
+	db          *bolt.DB
+	lockDir     string
+	lockOptions LockOptions
+	// locks serializes the changes of the lock files. bbolt holds an exclusive lock
+	// on the database, so all the contenders of the lock files are in this process
+	locks *sync.Mutex
+	stop  chan struct{}
+}
+
+//NewBoltCache opens or creates the bbolt database in path and starts the janitor
+//Locks are files in the <path>.locks directory
+func NewBoltCache(path string, lockOptions LockOptions) (BoltCache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return BoltCache{}, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(boltBucket))
+		return err
+	}); err != nil {
+		db.Close()
+		return BoltCache{}, err
+	}
+	lockDir := path + ".locks"
+	if err := os.MkdirAll(lockDir, 0700); err != nil {
+		db.Close()
+		return BoltCache{}, err
+	}
+
+	b := BoltCache{
+		db:          db,
+		lockDir:     lockDir,
+		lockOptions: lockOptions,
+		locks:       &sync.Mutex{},
+		stop:        make(chan struct{}),
+	}
+	go b.janitor(JanitorInterval)
+	return b, nil
+}
+
+//Close stops the janitor and closes the database
+func (b BoltCache) Close() error {
+	close(b.stop)
+	return b.db.Close()
+}
+
+//janitor removes the expired keys every interval
+func (b BoltCache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			if err := b.removeExpired(); err != nil {
+				logrus.Debug("Error removing expired keys from the cache")
+				logrus.Error(err)
+			}
+		}
+	}
+}
+
+//removeExpired deletes the expired keys
+func (b BoltCache) removeExpired() error {
+	now := time.Now()
+	removed := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(boltBucket)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var rec boltRecord
+			if err := json.Unmarshal(v, &rec); err != nil || rec.expired(now) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	logrus.WithField("removed", removed).Debug("Cache janitor run")
+	return err
+}
+
+//get reads a not expired record
+func (b BoltCache) get(key string) (boltRecord, error) {
+	var rec boltRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(boltBucket)).Get([]byte(key))
+		if v == nil {
+			return ErrKeyNotFound
+		}
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return err
+		}
+		if rec.expired(time.Now()) {
+			return ErrKeyNotFound
+		}
+		return nil
+	})
+	return rec, err
+}
+
+//put writes a record with a ttl, 0 means no expiration
+func (b BoltCache) put(key string, rec boltRecord, ttl time.Duration) error {
+	if ttl > 0 {
+		rec.ExpiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	v, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(boltBucket)).Put([]byte(key), v)
+	})
+}
+
+//GetKey gets the value of a key from the cache
+func (b BoltCache) GetKey(ctx context.Context, key string) (interface{}, error) {
+	rec, err := b.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Value == nil {
+		return nil, ErrWrongType
+	}
+	return string(*rec.Value), nil
+}
+
+//SetKey sets a key-value in the cache, values are stored as bytes
+func (b BoltCache) SetKey(ctx context.Context, ttl time.Duration, key string, value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	return b.put(key, boltRecord{Value: &data}, ttl)
+}
+
+//Exists check if a key exists in the cache
+func (b BoltCache) Exists(ctx context.Context, key string) (int64, error) {
+	if _, err := b.get(key); err == ErrKeyNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+//Delete removes keys from the cache
+func (b BoltCache) Delete(ctx context.Context, keys ...string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(boltBucket))
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//Scan returns the not expired keys matching a glob pattern
+func (b BoltCache) Scan(ctx context.Context, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	keys := make([]string, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(boltBucket)).ForEach(func(k, v []byte) error {
+			var rec boltRecord
+			if err := json.Unmarshal(v, &rec); err != nil || rec.expired(now) {
+				return nil
+			}
+			if ok, _ := path.Match(pattern, string(k)); ok {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+//Incr increments a counter, the ttl is set when the counter is created
+func (b BoltCache) Incr(ctx context.Context, ttl time.Duration, key string) (int64, error) {
+	var n int64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(boltBucket))
+		var rec boltRecord
+		if v := bucket.Get([]byte(key)); v != nil {
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+		}
+		if rec.Value == nil || rec.expired(time.Now()) {
+			rec = boltRecord{}
+			if ttl > 0 {
+				rec.ExpiresAt = time.Now().Add(ttl).UnixNano()
+			}
+		} else if _, err := fmt.Sscanf(string(*rec.Value), "%d", &n); err != nil {
+			return ErrWrongType
+		}
+		n++
+		value := []byte(strconv.FormatInt(n, 10))
+		rec.Value = &value
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+	return n, err
+}
+
+//TTL returns the remaining time to live of a key, NoExpiration if the key has no expiration
+func (b BoltCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	rec, err := b.get(key)
+	if err != nil {
+		return 0, err
+	}
+	if rec.ExpiresAt == 0 {
+		return NoExpiration, nil
+	}
+	return time.Until(time.Unix(0, rec.ExpiresAt)), nil
+}
+
+//fileLock is the Implementation of Lock for a lock file
+//The file holds a random token, so only the owner can extend or release it
+//The modification time of the file is the start of its lease, stale files are taken over
+type fileLock struct {
+	path  string
+	token []byte
+	locks *sync.Mutex
+	lease *lease
+}
+
+//SetLock creates the lock file of the key, waiting up to the lock options Wait
+//The lease is renewed in background until the lock is released
+func (b BoltCache) SetLock(ctx context.Context, key string) (Lock, error) {
+	sum := sha1.Sum([]byte(key))
+	lockPath := filepath.Join(b.lockDir, hex.EncodeToString(sum[:])+".lock")
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	token = []byte(hex.EncodeToString(token))
+
+	deadline := time.Now().Add(b.lockOptions.Wait)
+	for {
+		ok, err := b.tryLockFile(lockPath, token)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			logrus.Debug("Failed to acquire File Lock")
+			return nil, errors.New("lock already taken")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(b.lockOptions.RetryDelay):
+		}
+	}
+	logrus.Debug("File Lock acquired")
+
+	l := &fileLock{path: lockPath, token: token, locks: b.locks}
+	l.lease = startLease(key, b.lockOptions.Expiry/2, l.Extend)
+	return l, nil
+}
+
+//tryLockFile writes the token to the lock file if it does not exist or its lease is over
+//The check and the write are done holding the locks mutex, so a stale lock is taken over by one contender
+func (b BoltCache) tryLockFile(lockPath string, token []byte) (bool, error) {
+	b.locks.Lock()
+	defer b.locks.Unlock()
+	info, err := os.Stat(lockPath)
+	if err == nil {
+		if b.lockOptions.Expiry <= 0 || time.Since(info.ModTime()) <= b.lockOptions.Expiry {
+			return false, nil
+		}
+		logrus.WithField("path", lockPath).Debug("Taking over stale File Lock")
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	// The token is written to a temporary file and renamed, the lock file is never seen half written
+	tmp := lockPath + "." + string(token) + ".tmp"
+	if err := ioutil.WriteFile(tmp, token, 0600); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, lockPath); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
+
+//owned checks the lock file still holds the token of the lock, it must be called holding the locks mutex
+func (l *fileLock) owned() bool {
+	data, err := ioutil.ReadFile(l.path)
+	return err == nil && bytes.Equal(data, l.token)
+}
+
+//Extend resets the lease of the lock
+func (l *fileLock) Extend() error {
+	l.locks.Lock()
+	defer l.locks.Unlock()
+	if !l.owned() {
+		return ErrLockNotHeld
+	}
+	now := time.Now()
+	return os.Chtimes(l.path, now, now)
+}
+
+//Unlock stops the lease renewal and removes the lock file
+func (l *fileLock) Unlock() error {
+	l.lease.halt()
+	l.locks.Lock()
+	defer l.locks.Unlock()
+	if !l.owned() {
+		return ErrLockNotHeld
+	}
+	return os.Remove(l.path)
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBoltCache(t *testing.T) (BoltCache, func()) {
+	dir, err := ioutil.TempDir("", "boltcache")
+	assert.NoError(t, err)
+	b, err := NewBoltCache(filepath.Join(dir, "cache.db"), LockOptions{
+		Expiry:     2 * time.Second,
+		Wait:       50 * time.Millisecond,
+		RetryDelay: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	return b, func() {
+		b.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltSetGetKey(t *testing.T) {
+	b, cleanup := newTestBoltCache(t)
+	defer cleanup()
+
+	assert.NoError(t, b.SetKey(ctx, 5*time.Second, "key", "value"))
+	val, err := b.GetKey(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", val)
+
+	_, err = b.GetKey(ctx, "key-dont-exist")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestBoltExpiration(t *testing.T) {
+	b, cleanup := newTestBoltCache(t)
+	defer cleanup()
+
+	assert.NoError(t, b.SetKey(ctx, 20*time.Millisecond, "expiring", "value"))
+	assert.NoError(t, b.SetKey(ctx, 0, "persistent", "value"))
+	exists, _ := b.Exists(ctx, "expiring")
+	assert.Equal(t, int64(1), exists)
+	ttl, _ := b.TTL(ctx, "persistent")
+	assert.Equal(t, NoExpiration, ttl)
+
+	time.Sleep(30 * time.Millisecond)
+	exists, _ = b.Exists(ctx, "expiring")
+	assert.Equal(t, int64(0), exists)
+
+	assert.NoError(t, b.removeExpired())
+	keys, err := b.Scan(ctx, "*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"persistent"}, keys)
+}
+
+func TestBoltSurvivesRestart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "boltcache")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.db")
+
+	b, err := NewBoltCache(path, DefaultLockOptions())
+	assert.NoError(t, err)
+	assert.NoError(t, b.SetKey(ctx, time.Minute, "key", "value"))
+	assert.NoError(t, b.Close())
+
+	b, err = NewBoltCache(path, DefaultLockOptions())
+	assert.NoError(t, err)
+	defer b.Close()
+	val, err := b.GetKey(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", val)
+}
+
+func TestBoltLock(t *testing.T) {
+	b, cleanup := newTestBoltCache(t)
+	defer cleanup()
+
+	lock, err := b.SetLock(ctx, "mutex-bolt")
+	assert.NoError(t, err)
+	_, err = b.SetLock(ctx, "mutex-bolt")
+	assert.Error(t, err)
+	assert.NoError(t, lock.Extend())
+	assert.NoError(t, lock.Unlock())
+
+	lock, err = b.SetLock(ctx, "mutex-bolt")
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock())
+	assert.Equal(t, ErrLockNotHeld, lock.Unlock())
+}
+
+func TestBoltStaleLockTakeover(t *testing.T) {
+	b, cleanup := newTestBoltCache(t)
+	defer cleanup()
+
+	for i := 0; i < 20; i++ {
+		stale, err := b.SetLock(ctx, "mutex-stale")
+		assert.NoError(t, err)
+		// The holder died without releasing the lock
+		stale.(*fileLock).lease.halt()
+		old := time.Now().Add(-time.Minute)
+		assert.NoError(t, os.Chtimes(stale.(*fileLock).path, old, old))
+
+		var wg sync.WaitGroup
+		var acquired int32
+		var locks = make(chan Lock, 4)
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if lock, err := b.SetLock(ctx, "mutex-stale"); err == nil {
+					atomic.AddInt32(&acquired, 1)
+					locks <- lock
+				}
+			}()
+		}
+		wg.Wait()
+		close(locks)
+		assert.Equal(t, int32(1), acquired)
+		assert.Equal(t, ErrLockNotHeld, stale.Unlock())
+		for lock := range locks {
+			assert.NoError(t, lock.Unlock())
+		}
+	}
+}
+
+func TestBoltIncr(t *testing.T) {
+	b, cleanup := newTestBoltCache(t)
+	defer cleanup()
+
+	n, err := b.Incr(ctx, 20*time.Millisecond, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, _ = b.Incr(ctx, 20*time.Millisecond, "counter")
+	assert.Equal(t, int64(2), n)
+
+	time.Sleep(30 * time.Millisecond)
+	n, _ = b.Incr(ctx, 20*time.Millisecond, "counter")
+	assert.Equal(t, int64(1), n)
+}
@@ -2,7 +2,11 @@ package cache
 
 import (
 	"context"
-	"errors"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -12,35 +16,95 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+//NoExpiration is the TTL of the keys without expiration
+const NoExpiration time.Duration = -1
+
 //Cache is the interface that the app has to implement to use the cache
+//The users of the queries are stored through a ResultStore built on top of it
 type Cache interface {
 	GetKey(ctx context.Context, key string) (interface{}, error)
 	SetKey(ctx context.Context, ttl time.Duration, key string, value interface{}) error
-	SetLock(ctx context.Context, key string) error
-	ReleaseLock(key string) error
-	Push(ctx context.Context, ttl time.Duration, key string, values ...string) error
-	GetRange(ctx context.Context, key string, items int64) ([]string, error)
+	SetLock(ctx context.Context, key string) (Lock, error)
 	Exists(ctx context.Context, key string) (int64, error)
+	Delete(ctx context.Context, keys ...string) error
+	Scan(ctx context.Context, pattern string) ([]string, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Incr(ctx context.Context, ttl time.Duration, key string) (int64, error)
 }
 
 //RedisCache is the Implementation of Cache interface for Redis
 type RedisCache struct {
-	client  *redis.Client
-	redsync *redsync.Redsync
+	client      redis.UniversalClient
+	redsync     *redsync.Redsync
+	lockOptions LockOptions
+}
+
+//RedisOptions holds the connection options of the RedisCache
+type RedisOptions struct {
+	// Addrs is the address of a single node, the Sentinel addresses or the Cluster seed nodes
+	Addrs    []string
+	Password string
+	// DB is the database index, not supported by Redis Cluster
+	DB int
+	// MasterName enables Sentinel mode
+	MasterName string
+	// Cluster enables Redis Cluster mode, even with a single seed node
+	Cluster bool
+	// TLS enables TLS, TLSCAFile optionally sets a custom CA to verify the server
+	TLS       bool
+	TLSCAFile string
+	Lock      LockOptions
 }
 
 //NewRedisCache constructs the RedisCache object
-func NewRedisCache(addr string, password string) RedisCache {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-	})
+func NewRedisCache(opts RedisOptions) (RedisCache, error) {
+	uopts := &redis.UniversalOptions{
+		Addrs:      opts.Addrs,
+		Password:   opts.Password,
+		DB:         opts.DB,
+		MasterName: opts.MasterName,
+	}
+	if opts.TLS {
+		tlsConfig, err := newTLSConfig(opts.TLSCAFile)
+		if err != nil {
+			return RedisCache{}, err
+		}
+		uopts.TLSConfig = tlsConfig
+	}
+
+	var client redis.UniversalClient
+	if opts.Cluster {
+		logrus.WithField("addrs", opts.Addrs).Debug("Using Redis Cluster")
+		client = redis.NewClusterClient(uopts.Cluster())
+	} else {
+		// A MasterName selects Sentinel, multiple addresses select Cluster
+		client = redis.NewUniversalClient(uopts)
+	}
 	rs := redsync.New(goredis.NewPool(client))
 
 	return RedisCache{
-		client:  client,
-		redsync: rs,
+		client:      client,
+		redsync:     rs,
+		lockOptions: opts.Lock,
+	}, nil
+}
+
+//newTLSConfig returns the TLS configuration, using the system CAs if caFile is empty
+func newTLSConfig(caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM(ca); !ok {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
 	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
 }
 
 //GetKey gets the value of a key from the cache
@@ -53,34 +117,6 @@ func (r RedisCache) GetKey(ctx context.Context, key string) (interface{}, error)
 	}
 }
 
-//SetLock sets a distributed lock to the cache
-func (r RedisCache) SetLock(ctx context.Context, key string) error {
-	select {
-	case <-ctx.Done():
-		return errors.New("setRedisLock Context canceled")
-	default:
-		mutex := r.redsync.NewMutex(key)
-		if err := mutex.Lock(); err != nil {
-			logrus.Debug("Failed to acquire Redis Mutex Lock")
-			logrus.Error(err)
-			return err
-		} else {
-			logrus.Debug("Redis Mute Lock acquired")
-			return nil
-		}
-	}
-}
-
-//ReleaseLock release the cache distributed Lock
-func (r RedisCache) ReleaseLock(key string) error {
-	mutex := r.redsync.NewMutex(key)
-	if ok, err := mutex.Unlock(); !ok || err != nil {
-		return err
-	} else {
-		return nil
-	}
-}
-
 //SetKey sets a key-value in Redis cache
 func (r RedisCache) SetKey(ctx context.Context, ttl time.Duration, key string, value interface{}) error {
 	err := r.client.Set(ctx, key, value, ttl).Err()
@@ -90,51 +126,103 @@ func (r RedisCache) SetKey(ctx context.Context, ttl time.Duration, key string, v
 	return nil
 }
 
-//Push push values to a redis list
-func (r RedisCache) Push(ctx context.Context, ttl time.Duration, key string, values ...string) error {
-	_ = r.client.Del(ctx, key)
-	if val, err := r.client.LPush(ctx, key, values).Result(); err != nil {
-		return err
+//Exists check if a key exists in redis
+func (r RedisCache) Exists(ctx context.Context, key string) (int64, error) {
+	value, err := r.client.Exists(ctx, key).Result()
+	logrus.WithFields(logrus.Fields{
+		"key":   key,
+		"value": value,
+	}).Debug("Checking if key exists in the cache")
+	if err != nil {
+		logrus.Error(err)
+		return 0, err
 	} else {
-		logrus.WithFields(logrus.Fields{
-			"insertedItems": val,
-		}).Debug("Pushing to the cache")
+		return value, err
 	}
+}
 
-	logrus.WithField("expiration", ttl).Debug("Setting key expiration")
-	if _, err := r.client.Expire(ctx, key, ttl).Result(); err != nil {
-		return err
+//Delete removes keys from redis
+//Keys are deleted one by one, in Redis Cluster they might belong to different slots
+func (r RedisCache) Delete(ctx context.Context, keys ...string) error {
+	logrus.WithField("keys", keys).Debug("Deleting keys from the cache")
+	for _, key := range keys {
+		if err := r.client.Del(ctx, key).Err(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-//GetRange gets a range of values from redis
-func (r RedisCache) GetRange(ctx context.Context, key string, items int64) ([]string, error) {
-	value, err := r.client.LRange(ctx, key, 0, items).Result()
-	logrus.WithFields(logrus.Fields{
-		"key":   key,
-		"start": 1,
-		"stop":  items,
-		"got":   len(value),
-	}).Debug("GetRange")
+//Scan returns the keys matching a pattern, scanning all the masters in Redis Cluster
+func (r RedisCache) Scan(ctx context.Context, pattern string) ([]string, error) {
+	var mu sync.Mutex
+	keys := make([]string, 0)
+	scan := func(ctx context.Context, client *redis.Client) error {
+		iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			keys = append(keys, iter.Val())
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
 
+	var err error
+	switch client := r.client.(type) {
+	case *redis.ClusterClient:
+		err = client.ForEachMaster(ctx, scan)
+	case *redis.Client:
+		err = scan(ctx, client)
+	default:
+		iter := r.client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		err = iter.Err()
+	}
+	logrus.WithFields(logrus.Fields{
+		"pattern": pattern,
+		"got":     len(keys),
+	}).Debug("Scan")
 	if err != nil {
 		return nil, err
 	}
-	return value, nil
+	return keys, nil
 }
 
-//Exists check if a key exists in redis
-func (r RedisCache) Exists(ctx context.Context, key string) (int64, error) {
-	value, err := r.client.Exists(ctx, key).Result()
-	logrus.WithFields(logrus.Fields{
-		"key":   key,
-		"value": value,
-	}).Debug("Checking if key exists in the cache")
+//incrScript increments a counter and sets its ttl in milliseconds when it has none,
+//so a counter never outlives its window even if the client fails between the commands
+const incrScript = `
+local n = redis.call("INCR", KEYS[1])
+if tonumber(ARGV[1]) > 0 and redis.call("PTTL", KEYS[1]) == -1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`
+
+//Incr increments a counter, the ttl is set when the counter has no expiration
+func (r RedisCache) Incr(ctx context.Context, ttl time.Duration, key string) (int64, error) {
+	return r.client.Eval(ctx, incrScript, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+//Eval runs a Lua script, the keys of a script must be in the same slot for Cluster
+func (r RedisCache) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.client.Eval(ctx, script, keys, args...).Result()
+}
+
+//TTL returns the remaining time to live of a key, NoExpiration if the key has no expiration
+//It returns an error if the key does not exist
+func (r RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.TTL(ctx, key).Result()
 	if err != nil {
-		logrus.Error(err)
 		return 0, err
-	} else {
-		return value, err
 	}
+	// go-redis returns the raw -1/-2 replies
+	switch ttl {
+	case -2:
+		return 0, redis.Nil
+	case -1:
+		return NoExpiration, nil
+	}
+	return ttl, nil
 }
@@ -19,13 +19,13 @@ var (
 func TestMain(m *testing.M) {
 	// call flag.Parse() here if TestMain uses flags
 	s, _ = miniredis.Run()
-	c = NewRedisCache(s.Addr(), "")
+	c, _ = NewRedisCache(RedisOptions{Addrs: []string{s.Addr()}, Lock: DefaultLockOptions()})
 	ctx = context.Background()
 	os.Exit(m.Run())
 }
 
 func TestSetKey(t *testing.T) {
-	err := c.SetKey(ctx, "key", "value", 5*time.Second)
+	err := c.SetKey(ctx, 5*time.Second, "key", "value")
 	assert.NoError(t, err)
 }
 
@@ -41,26 +41,62 @@ func TestGetKeyError(t *testing.T) {
 	assert.Equal(t, val, nil)
 }
 
-func TestPush(t *testing.T) {
-	var values = []string{"testvalue1", "testvalue2"}
-	err := c.Push(ctx, 30*time.Second, "pushkey", values...)
+func TestNewRedisCacheDB(t *testing.T) {
+	dbc, err := NewRedisCache(RedisOptions{Addrs: []string{s.Addr()}, DB: 2})
 	assert.NoError(t, err)
+	assert.NoError(t, dbc.SetKey(ctx, 5*time.Second, "dbkey", "value"))
+	assert.True(t, s.DB(2).Exists("dbkey"))
+	assert.False(t, s.DB(0).Exists("dbkey"))
 }
 
-func TestPushNoValues(t *testing.T) {
-	var values = []string{}
-	err := c.Push(ctx, 30*time.Second, "pushkeyNovalue", values...)
+func TestNewRedisCacheBadCA(t *testing.T) {
+	_, err := NewRedisCache(RedisOptions{Addrs: []string{s.Addr()}, TLS: true, TLSCAFile: "cache_test.go"})
+	assert.Error(t, err)
+}
+
+func TestDelete(t *testing.T) {
+	assert.NoError(t, c.SetKey(ctx, 5*time.Second, "deletekey", "value"))
+	assert.NoError(t, c.Delete(ctx, "deletekey"))
+	assert.False(t, s.Exists("deletekey"))
+}
+
+func TestScan(t *testing.T) {
+	assert.NoError(t, c.SetKey(ctx, 5*time.Second, "scan:a", "value"))
+	assert.NoError(t, c.SetKey(ctx, 5*time.Second, "scan:b", "value"))
+	assert.NoError(t, c.SetKey(ctx, 5*time.Second, "other", "value"))
+	keys, err := c.Scan(ctx, "scan:*")
 	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"scan:a", "scan:b"}, keys)
 }
 
-func TestGetRange(t *testing.T) {
-	values, err := c.GetRange(ctx, "pushkey", 5)
+func TestTTL(t *testing.T) {
+	assert.NoError(t, c.SetKey(ctx, 30*time.Second, "ttlkey", "value"))
+	ttl, err := c.TTL(ctx, "ttlkey")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, ttl)
+
+	assert.NoError(t, c.SetKey(ctx, 0, "ttlkey-noexpire", "value"))
+	ttl, err = c.TTL(ctx, "ttlkey-noexpire")
 	assert.NoError(t, err)
-	assert.Equal(t, len(values), 2)
+	assert.Equal(t, NoExpiration, ttl)
+
+	_, err = c.TTL(ctx, "ttlkey-dont-exist")
+	assert.Error(t, err)
 }
 
-func TestGetRangeKeyNotExist(t *testing.T) {
-	values2, err := c.GetRange(ctx, "noexistkey", 5)
+func TestIncr(t *testing.T) {
+	n, err := c.Incr(ctx, 30*time.Second, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = c.Incr(ctx, 30*time.Second, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, 30*time.Second, s.TTL("counter"))
+
+	// A counter left without expiration gets one on the next increment
+	s.Set("counter-noexpire", "5")
+	n, err = c.Incr(ctx, 30*time.Second, "counter-noexpire")
 	assert.NoError(t, err)
-	assert.Equal(t, len(values2), 0)
+	assert.Equal(t, int64(6), n)
+	assert.Equal(t, 30*time.Second, s.TTL("counter-noexpire"))
 }
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+//ErrCorruptValue is returned when a cached value can not be decoded
+var ErrCorruptValue = errors.New("corrupt cache value")
+
+//Codec encodes and decodes the values stored in the cache
+//Encoded values start with a format byte, so a Codec decodes the values
+//written by any other Codec and values in a unknown format are reported as corrupt
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// The format byte holds the serializer in the low nibble and the compression in the high nibble
+const (
+	serializerJSON    byte = 0x01
+	serializerMsgpack byte = 0x02
+
+	compressionNone byte = 0x00
+	compressionGzip byte = 0x10
+	compressionZstd byte = 0x20
+)
+
+//Codecs are the names accepted by NewCodec
+var Codecs = []string{"json", "msgpack", "json+gzip", "msgpack+gzip", "json+zstd", "msgpack+zstd"}
+
+//formatCodec is the Implementation of Codec for a serializer and a compression
+type formatCodec struct {
+	format byte
+}
+
+//NewCodec returns the Codec for a name in the form serializer[+compression]
+func NewCodec(name string) (Codec, error) {
+	parts := strings.SplitN(strings.ToLower(name), "+", 2)
+	var format byte
+	switch parts[0] {
+	case "json":
+		format = serializerJSON
+	case "msgpack":
+		format = serializerMsgpack
+	default:
+		return nil, fmt.Errorf("unknown codec %q, valid codecs are %s", name, strings.Join(Codecs, ", "))
+	}
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "gzip":
+			format |= compressionGzip
+		case "zstd":
+			format |= compressionZstd
+		default:
+			return nil, fmt.Errorf("unknown codec %q, valid codecs are %s", name, strings.Join(Codecs, ", "))
+		}
+	}
+	return formatCodec{format: format}, nil
+}
+
+//Marshal serializes and compresses v and prepends the format byte
+func (c formatCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := serialize(c.format&0x0f, v)
+	if err != nil {
+		return nil, err
+	}
+	data, err = compress(c.format&0xf0, data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{c.format}, data...), nil
+}
+
+//Unmarshal decodes data using the format in its first byte
+func (c formatCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) < 2 {
+		return ErrCorruptValue
+	}
+	format := data[0]
+	payload, err := decompress(format&0xf0, data[1:])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptValue, err)
+	}
+	if err := deserialize(format&0x0f, payload, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptValue, err)
+	}
+	return nil
+}
+
+func serialize(serializer byte, v interface{}) ([]byte, error) {
+	switch serializer {
+	case serializerJSON:
+		return json.Marshal(v)
+	case serializerMsgpack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		// Reuse the json tags, omitempty drops the null fields of the github structs
+		enc.SetCustomStructTag("json")
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown serializer %#x", serializer)
+}
+
+func deserialize(serializer byte, data []byte, v interface{}) error {
+	switch serializer {
+	case serializerJSON:
+		return json.Unmarshal(data, v)
+	case serializerMsgpack:
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		return dec.Decode(v)
+	}
+	return fmt.Errorf("unknown serializer %#x", serializer)
+}
+
+func compress(compression byte, data []byte) ([]byte, error) {
+	switch compression {
+	case compressionNone:
+		return data, nil
+	case compressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case compressionZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer enc.Close()
+		return enc.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("unknown compression %#x", compression)
+}
+
+func decompress(compression byte, data []byte) ([]byte, error) {
+	switch compression {
+	case compressionNone:
+		return data, nil
+	case compressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case compressionZstd:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		return dec.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unknown compression %#x", compression)
+}
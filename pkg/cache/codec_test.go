@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codecTestValue struct {
+	Login       *string `json:"login,omitempty"`
+	PublicRepos *int    `json:"public_repos,omitempty"`
+	Name        *string `json:"name,omitempty"`
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	login, repos := "octocat", 8
+	for _, name := range Codecs {
+		codec, err := NewCodec(name)
+		assert.NoError(t, err)
+
+		data, err := codec.Marshal(codecTestValue{Login: &login, PublicRepos: &repos})
+		assert.NoError(t, err, name)
+
+		// Any codec decodes the values written by the others
+		jsonCodec, _ := NewCodec("json")
+		var v codecTestValue
+		assert.NoError(t, jsonCodec.Unmarshal(data, &v), name)
+		assert.Equal(t, login, *v.Login, name)
+		assert.Equal(t, repos, *v.PublicRepos, name)
+		assert.Nil(t, v.Name, name)
+	}
+}
+
+func TestNewCodecUnknown(t *testing.T) {
+	_, err := NewCodec("xml")
+	assert.Error(t, err)
+	_, err = NewCodec("json+lz4")
+	assert.Error(t, err)
+}
+
+func TestCodecCorruptValues(t *testing.T) {
+	codec, _ := NewCodec("msgpack+zstd")
+	var v codecTestValue
+	// Values written before the codecs had no format byte
+	err := codec.Unmarshal([]byte(`{"login":"octocat"}`), &v)
+	assert.True(t, errors.Is(err, ErrCorruptValue))
+
+	err = codec.Unmarshal([]byte{serializerMsgpack | compressionZstd, 0x01, 0x02}, &v)
+	assert.True(t, errors.Is(err, ErrCorruptValue))
+
+	err = codec.Unmarshal(nil, &v)
+	assert.True(t, errors.Is(err, ErrCorruptValue))
+}
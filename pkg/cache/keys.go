@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+//SchemaVersion is the version of the cached values layout
+//Bump it when the stored users or their order change, the keys of older versions
+//are not read anymore and expire with their TTL
+const SchemaVersion = 2
+
+//Query holds the components of a users query that identify its cached result
+type Query struct {
+	Location string
+	Sort     string
+	Filters  map[string]string
+}
+
+//KeyBuilder builds the namespaced and versioned keys of the cache
+//Keys have the form <prefix>:v<version>:<kind>:<components>, the keys that do not depend
+//on the cached values layout have the form <prefix>:<kind>:<components>
+type KeyBuilder struct {
+	prefix  string
+	version int
+}
+
+//NewKeyBuilder returns a KeyBuilder for the current SchemaVersion
+//The prefix isolates the environments sharing the same cache
+func NewKeyBuilder(prefix string) KeyBuilder {
+	return KeyBuilder{
+		prefix:  prefix,
+		version: SchemaVersion,
+	}
+}
+
+//namespace returns the common part of all the keys
+func (k KeyBuilder) namespace() string {
+	if k.prefix == "" {
+		return fmt.Sprintf("v%d", k.version)
+	}
+	return fmt.Sprintf("%s:v%d", k.prefix, k.version)
+}
+
+//unversioned returns the common part of the keys of a kind kept across SchemaVersion bumps
+func (k KeyBuilder) unversioned(kind string) string {
+	if k.prefix == "" {
+		return kind
+	}
+	return k.prefix + ":" + kind
+}
+
+//Users returns the key of the users of a query
+func (k KeyBuilder) Users(q Query) string {
+	return k.namespace() + ":users:" + q.id()
+}
+
+//Lock returns the key of the distributed lock of a query
+func (k KeyBuilder) Lock(q Query) string {
+	return k.namespace() + ":lock:" + q.id()
+}
+
+//Validators returns the key of the conditional request validators of a Github resource
+func (k KeyBuilder) Validators(kind string, id string) string {
+	return k.namespace() + ":etag:" + kind + ":" + escapeKeyComponent(id)
+}
+
+//Counter returns the key of a counter, id identifies the counter window
+func (k KeyBuilder) Counter(name string, id string) string {
+	return k.unversioned("counter") + ":" + escapeKeyComponent(name) + ":" + escapeKeyComponent(id)
+}
+
+//Bucket returns the key of the token bucket of a client
+func (k KeyBuilder) Bucket(name string, client string) string {
+	return k.unversioned("bucket") + ":" + escapeKeyComponent(name) + ":" + escapeKeyComponent(client)
+}
+
+//APIKey returns the key of an API key, id is the hash of the API key
+//API keys are not cached values, they are kept when SchemaVersion is bumped
+func (k KeyBuilder) APIKey(id string) string {
+	return k.unversioned("apikey") + ":" + escapeKeyComponent(id)
+}
+
+//UsersPattern returns a pattern matching the users keys of the current version
+func (k KeyBuilder) UsersPattern() string {
+	return k.namespace() + ":users:*"
+}
+
+//UsersLocationPattern returns a pattern matching the users keys of the locations starting with prefix
+func (k KeyBuilder) UsersLocationPattern(prefix string) string {
+	return k.namespace() + ":users:" + escapeKeyComponent(NormalizeLocation(prefix)) + "*"
+}
+
+//ParseUsers returns the query of a users key of the current version
+func (k KeyBuilder) ParseUsers(key string) (Query, bool) {
+	prefix := k.namespace() + ":users:"
+	if !strings.HasPrefix(key, prefix) {
+		return Query{}, false
+	}
+	parts := strings.Split(strings.TrimPrefix(key, prefix), ":")
+	location, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return Query{}, false
+	}
+	q := Query{Location: location, Filters: map[string]string{}}
+	for i, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return Query{}, false
+		}
+		name, _ := url.PathUnescape(kv[0])
+		value, _ := url.PathUnescape(kv[1])
+		if i == 0 && name == "sort" {
+			q.Sort = value
+		} else {
+			q.Filters[name] = value
+		}
+	}
+	return q, true
+}
+
+//IsCurrent checks if a key belongs to this namespace and version
+func (k KeyBuilder) IsCurrent(key string) bool {
+	return strings.HasPrefix(key, k.namespace()+":")
+}
+
+//NormalizeLocation returns the canonical form of a location
+func NormalizeLocation(location string) string {
+	return strings.ToLower(strings.Join(strings.Fields(location), " "))
+}
+
+//id returns the key components of a query, filters are sorted to get stable keys
+func (q Query) id() string {
+	parts := []string{escapeKeyComponent(NormalizeLocation(q.Location)), "sort=" + escapeKeyComponent(q.Sort)}
+	names := make([]string, 0, len(q.Filters))
+	for name := range q.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, escapeKeyComponent(name)+"="+escapeKeyComponent(q.Filters[name]))
+	}
+	return strings.Join(parts, ":")
+}
+
+//escapeKeyComponent escapes the separators of a key component
+func escapeKeyComponent(s string) string {
+	return strings.NewReplacer(":", "%3A", "*", "%2A").Replace(url.PathEscape(s))
+}
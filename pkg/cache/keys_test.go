@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyBuilderUsers(t *testing.T) {
+	k := NewKeyBuilder("prod")
+	key := k.Users(Query{Location: "  San   Francisco ", Sort: "repos"})
+	assert.Equal(t, "prod:v2:users:san%20francisco:sort=repos", key)
+	assert.Equal(t, key, k.Users(Query{Location: "san francisco", Sort: "repos"}))
+	assert.True(t, k.IsCurrent(key))
+}
+
+func TestKeyBuilderFiltersAreSorted(t *testing.T) {
+	k := NewKeyBuilder("")
+	key := k.Users(Query{Location: "Barcelona", Sort: "repos", Filters: map[string]string{"type": "user", "language": "go:lang"}})
+	assert.Equal(t, "v2:users:barcelona:sort=repos:language=go%3Alang:type=user", key)
+}
+
+func TestKeyBuilderIgnoresOtherVersions(t *testing.T) {
+	k := NewKeyBuilder("prod")
+	assert.False(t, k.IsCurrent("Barcelona"))
+	assert.False(t, k.IsCurrent("prod:v1:users:barcelona:sort=repos"))
+	assert.False(t, k.IsCurrent("staging:v2:users:barcelona:sort=repos"))
+}
+
+func TestKeyBuilderParseUsers(t *testing.T) {
+	k := NewKeyBuilder("prod")
+	q := Query{Location: "san francisco", Sort: "repos", Filters: map[string]string{"language": "go:lang"}}
+	parsed, ok := k.ParseUsers(k.Users(q))
+	assert.True(t, ok)
+	assert.Equal(t, q, parsed)
+
+	_, ok = k.ParseUsers(k.Lock(q))
+	assert.False(t, ok)
+}
+
+func TestKeyBuilderUnversionedKeys(t *testing.T) {
+	current := NewKeyBuilder("prod")
+	next := KeyBuilder{prefix: "prod", version: SchemaVersion + 1}
+	assert.Equal(t, "prod:apikey:abc", current.APIKey("abc"))
+	assert.Equal(t, "apikey:abc", NewKeyBuilder("").APIKey("abc"))
+	assert.Equal(t, current.Counter("quota-ci", "42"), next.Counter("quota-ci", "42"))
+	assert.Equal(t, current.Bucket("requests", "ip:1.2.3.4"), next.Bucket("requests", "ip:1.2.3.4"))
+	assert.NotEqual(t, current.Users(Query{Location: "barcelona"}), next.Users(Query{Location: "barcelona"}))
+
+	// An API key stored before a SchemaVersion bump still resolves
+	assert.NoError(t, c.SetKey(ctx, 0, current.APIKey("abc"), `{"name":"ci"}`))
+	value, err := c.GetKey(ctx, next.APIKey("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"ci"}`, value)
+	assert.False(t, current.IsCurrent(current.APIKey("abc")))
+}
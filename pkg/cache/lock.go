@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"github.com/sirupsen/logrus"
+)
+
+//ErrLockNotHeld is returned when a lock is released or extended after losing it
+var ErrLockNotHeld = errors.New("lock is not held")
+
+//Lock is a distributed lock acquired with SetLock
+type Lock interface {
+	Unlock() error
+	Extend() error
+}
+
+//LockOptions configures the distributed locks
+type LockOptions struct {
+	// Expiry is the lease of the lock, it is extended automatically while the lock is held
+	Expiry time.Duration
+	// Wait is the maximum time SetLock waits to acquire the lock
+	Wait time.Duration
+	// RetryDelay is the time between attempts to acquire the lock
+	RetryDelay time.Duration
+}
+
+//DefaultLockOptions returns the default LockOptions
+func DefaultLockOptions() LockOptions {
+	return LockOptions{
+		Expiry:     8 * time.Second,
+		Wait:       10 * time.Second,
+		RetryDelay: 100 * time.Millisecond,
+	}
+}
+
+//tries returns the number of attempts to acquire a lock within the Wait time
+func (o LockOptions) tries() int {
+	if o.RetryDelay <= 0 {
+		return 1
+	}
+	return int(o.Wait/o.RetryDelay) + 1
+}
+
+//lease renews a lock in background until it is stopped
+type lease struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+//startLease calls extend every interval until the lease is stopped or extend fails
+func startLease(key string, interval time.Duration, extend func() error) *lease {
+	l := &lease{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(l.done)
+		if interval <= 0 {
+			<-l.stop
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				if err := extend(); err != nil {
+					logrus.WithField("key", key).Debug("Failed to extend Lock")
+					logrus.Error(err)
+					return
+				}
+				logrus.WithField("key", key).Debug("Lock extended")
+			}
+		}
+	}()
+	return l
+}
+
+//halt stops the renewal and waits for it to finish
+func (l *lease) halt() {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+}
+
+//redisLock is the Implementation of Lock for the redsync mutexes
+//The mutex holds the token of the lock, so only the owner can extend or release it
+type redisLock struct {
+	mutex *redsync.Mutex
+	lease *lease
+}
+
+//SetLock sets a distributed lock to the cache
+//The lease is renewed in background until the lock is released
+func (r RedisCache) SetLock(ctx context.Context, key string) (Lock, error) {
+	mutex := r.redsync.NewMutex(key,
+		redsync.WithExpiry(r.lockOptions.Expiry),
+		redsync.WithTries(r.lockOptions.tries()),
+		redsync.WithRetryDelay(r.lockOptions.RetryDelay),
+	)
+	if err := mutex.LockContext(ctx); err != nil {
+		logrus.Debug("Failed to acquire Redis Mutex Lock")
+		logrus.Error(err)
+		return nil, err
+	}
+	logrus.Debug("Redis Mutex Lock acquired")
+
+	l := &redisLock{mutex: mutex}
+	l.lease = startLease(key, r.lockOptions.Expiry/2, l.Extend)
+	return l, nil
+}
+
+//Extend resets the lease of the lock
+func (l *redisLock) Extend() error {
+	if ok, err := l.mutex.Extend(); err != nil {
+		return err
+	} else if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+//Unlock stops the lease renewal and releases the lock
+func (l *redisLock) Unlock() error {
+	l.lease.halt()
+	if ok, err := l.mutex.Unlock(); err != nil {
+		return err
+	} else if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lockTestCache(t *testing.T, lockOptions LockOptions) RedisCache {
+	lc, err := NewRedisCache(RedisOptions{Addrs: []string{s.Addr()}, Lock: lockOptions})
+	assert.NoError(t, err)
+	return lc
+}
+
+func TestSetLockExcludesOtherOwners(t *testing.T) {
+	lc := lockTestCache(t, LockOptions{Expiry: 2 * time.Second, Wait: 50 * time.Millisecond, RetryDelay: 10 * time.Millisecond})
+	lock, err := lc.SetLock(ctx, "mutex-exclusion")
+	assert.NoError(t, err)
+
+	_, err = lc.SetLock(ctx, "mutex-exclusion")
+	assert.Error(t, err)
+
+	assert.NoError(t, lock.Unlock())
+	assert.False(t, s.Exists("mutex-exclusion"))
+
+	lock, err = lc.SetLock(ctx, "mutex-exclusion")
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock())
+}
+
+func TestSetLockMutualExclusion(t *testing.T) {
+	lc := lockTestCache(t, LockOptions{Expiry: 2 * time.Second, Wait: 5 * time.Second, RetryDelay: 10 * time.Millisecond})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	holders, maxHolders := 0, 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := lc.SetLock(ctx, "mutex-concurrent")
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			assert.NoError(t, lock.Unlock())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, maxHolders)
+}
+
+func TestLockExtend(t *testing.T) {
+	lc := lockTestCache(t, LockOptions{Expiry: 2 * time.Second, RetryDelay: 10 * time.Millisecond})
+	lock, err := lc.SetLock(ctx, "mutex-extend")
+	assert.NoError(t, err)
+
+	s.FastForward(time.Second)
+	assert.NoError(t, lock.Extend())
+	assert.True(t, s.TTL("mutex-extend") > time.Second)
+	assert.NoError(t, lock.Unlock())
+}
+
+func TestLockIsRenewedWhileHeld(t *testing.T) {
+	lc := lockTestCache(t, LockOptions{Expiry: 200 * time.Millisecond, RetryDelay: 10 * time.Millisecond})
+	lock, err := lc.SetLock(ctx, "mutex-renew")
+	assert.NoError(t, err)
+
+	s.FastForward(150 * time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	assert.True(t, s.Exists("mutex-renew"))
+	assert.True(t, s.TTL("mutex-renew") > 100*time.Millisecond)
+	assert.NoError(t, lock.Unlock())
+}
+
+func TestUnlockLostLock(t *testing.T) {
+	lc := lockTestCache(t, LockOptions{Expiry: 2 * time.Second, RetryDelay: 10 * time.Millisecond})
+	lock, err := lc.SetLock(ctx, "mutex-lost")
+	assert.NoError(t, err)
+
+	s.Del("mutex-lost")
+	assert.Equal(t, ErrLockNotHeld, lock.Unlock())
+}
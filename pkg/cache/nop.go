@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+//NopCache is the Implementation of Cache that stores nothing
+//It is used when the cache is disabled, every key is missing and the locks are always acquired
+type NopCache struct{}
+
+//nopLock is the Lock of a NopCache
+type nopLock struct{}
+
+//Unlock does nothing
+func (nopLock) Unlock() error { return nil }
+
+//Extend does nothing
+func (nopLock) Extend() error { return nil }
+
+//GetKey always returns ErrKeyNotFound
+func (NopCache) GetKey(ctx context.Context, key string) (interface{}, error) {
+	return nil, ErrKeyNotFound
+}
+
+//SetKey discards the value
+func (NopCache) SetKey(ctx context.Context, ttl time.Duration, key string, value interface{}) error {
+	return nil
+}
+
+//SetLock returns a Lock that is always acquired
+func (NopCache) SetLock(ctx context.Context, key string) (Lock, error) {
+	return nopLock{}, nil
+}
+
+//Exists always returns 0
+func (NopCache) Exists(ctx context.Context, key string) (int64, error) {
+	return 0, nil
+}
+
+//Delete does nothing
+func (NopCache) Delete(ctx context.Context, keys ...string) error {
+	return nil
+}
+
+//Scan returns no keys
+func (NopCache) Scan(ctx context.Context, pattern string) ([]string, error) {
+	return nil, nil
+}
+
+//TTL always returns ErrKeyNotFound
+func (NopCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return 0, ErrKeyNotFound
+}
+
+//Incr returns 1, as every counter is new
+func (NopCache) Incr(ctx context.Context, ttl time.Duration, key string) (int64, error) {
+	return 1, nil
+}
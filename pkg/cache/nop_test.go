@@ -0,0 +1,17 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNopResultStore(t *testing.T) {
+	codec, _ := NewCodec("json")
+	store := NewResultStore(NopCache{}, NewKeyBuilder("test"), codec)
+	q := Query{Location: "barcelona", Sort: "repos"}
+	assert.NoError(t, store.PutResult(ctx, time.Minute, Result{Query: q, Empty: true}))
+	_, err := store.GetResult(ctx, q)
+	assert.Equal(t, ErrResultNotFound, err)
+}
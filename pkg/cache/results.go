@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+)
+
+//ErrResultNotFound is returned by a ResultStore when a query has no valid result stored
+var ErrResultNotFound = errors.New("result not found")
+
+//Result is a ranked list of users for a query with its metadata
+type Result struct {
+	Query Query `json:"query"`
+	// Users are ranked by the query sort
+	Users []*github.User `json:"users"`
+	// TotalCount is the number of users matching the query in Github
+	TotalCount int `json:"total_count"`
+	// Failed are the logins whose details could not be fetched
+	Failed    []string  `json:"failed,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// Empty is set when no user matches the query
+	Empty bool `json:"empty"`
+}
+
+//Complete checks if the result has the first items users of the query
+//Partial results are never complete, users are missing from the ranking
+func (r Result) Complete(items int) bool {
+	if r.Empty {
+		return true
+	}
+	if len(r.Failed) > 0 {
+		return false
+	}
+	// All the users of the query are stored
+	return len(r.Users) >= items || len(r.Users) >= r.TotalCount
+}
+
+//Serves checks if the result can be returned for items users, partial results are
+//only returned to the callers that accept them
+func (r Result) Serves(items int, partial bool) bool {
+	if r.Complete(items) {
+		return true
+	}
+	return partial && (len(r.Users) >= items || len(r.Users)+len(r.Failed) >= r.TotalCount)
+}
+
+//ResultStore is the interface to store the results of the queries
+type ResultStore interface {
+	GetResult(ctx context.Context, q Query) (Result, error)
+	PutResult(ctx context.Context, ttl time.Duration, r Result) error
+}
+
+//cacheResultStore is the Implementation of ResultStore on top of a Cache
+//Every result is stored encoded in a single key
+type cacheResultStore struct {
+	cache Cache
+	keys  KeyBuilder
+	codec Codec
+}
+
+//NewResultStore returns a ResultStore that keeps the results in a Cache
+func NewResultStore(c Cache, keys KeyBuilder, codec Codec) ResultStore {
+	return cacheResultStore{
+		cache: c,
+		keys:  keys,
+		codec: codec,
+	}
+}
+
+//GetResult gets the result of a query, ErrResultNotFound if it is not stored
+//Results that can not be decoded are evicted and reported as not found
+func (s cacheResultStore) GetResult(ctx context.Context, q Query) (Result, error) {
+	key := s.keys.Users(q)
+	value, err := s.cache.GetKey(ctx, key)
+	if err != nil {
+		if exists, eerr := s.cache.Exists(ctx, key); eerr == nil && exists == 0 {
+			return Result{}, ErrResultNotFound
+		}
+		return Result{}, err
+	}
+
+	var r Result
+	if err := s.codec.Unmarshal(valueBytes(value), &r); err != nil {
+		logrus.WithField("key", key).Info("Evicting corrupt result from the cache")
+		logrus.Error(err)
+		if err := s.cache.Delete(ctx, key); err != nil {
+			logrus.Error(err)
+		}
+		return Result{}, ErrResultNotFound
+	}
+	return r, nil
+}
+
+//PutResult stores the result of a query
+func (s cacheResultStore) PutResult(ctx context.Context, ttl time.Duration, r Result) error {
+	data, err := s.codec.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.cache.SetKey(ctx, ttl, s.keys.Users(r.Query), data)
+}
+
+//valueBytes returns the bytes of a value got from a Cache
+func valueBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
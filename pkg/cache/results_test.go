@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResultStore(t *testing.T) ResultStore {
+	codec, err := NewCodec("msgpack+gzip")
+	assert.NoError(t, err)
+	return NewResultStore(c, NewKeyBuilder("test"), codec)
+}
+
+func TestResultStorePutGet(t *testing.T) {
+	store := newTestResultStore(t)
+	q := Query{Location: "barcelona", Sort: "repos"}
+	r := Result{
+		Query:      q,
+		Users:      []*github.User{{Login: github.String("octocat"), PublicRepos: github.Int(8)}},
+		TotalCount: 40,
+		FetchedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	assert.NoError(t, store.PutResult(ctx, time.Minute, r))
+
+	got, err := store.GetResult(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, "octocat", got.Users[0].GetLogin())
+	assert.Equal(t, 40, got.TotalCount)
+	assert.True(t, r.FetchedAt.Equal(got.FetchedAt))
+	assert.False(t, got.Empty)
+}
+
+func TestResultStoreEmptyResult(t *testing.T) {
+	store := newTestResultStore(t)
+	q := Query{Location: "nowhere", Sort: "repos"}
+	assert.NoError(t, store.PutResult(ctx, time.Minute, Result{Query: q, Empty: true}))
+
+	got, err := store.GetResult(ctx, q)
+	assert.NoError(t, err)
+	assert.True(t, got.Empty)
+	assert.True(t, got.Complete(10))
+}
+
+func TestResultStoreAllFailed(t *testing.T) {
+	store := newTestResultStore(t)
+	q := Query{Location: "failing", Sort: "repos"}
+	r := Result{Query: q, TotalCount: 2, Failed: []string{"octocat", "hubot"}}
+	assert.NoError(t, store.PutResult(ctx, time.Minute, r))
+
+	got, err := store.GetResult(ctx, q)
+	assert.NoError(t, err)
+	assert.False(t, got.Empty)
+	assert.False(t, got.Complete(10))
+}
+
+func TestResultStoreNotFound(t *testing.T) {
+	store := newTestResultStore(t)
+	_, err := store.GetResult(ctx, Query{Location: "not-cached", Sort: "repos"})
+	assert.Equal(t, ErrResultNotFound, err)
+}
+
+func TestResultStoreEvictsCorruptResults(t *testing.T) {
+	store := newTestResultStore(t)
+	q := Query{Location: "corrupt", Sort: "repos"}
+	key := NewKeyBuilder("test").Users(q)
+	assert.NoError(t, c.SetKey(ctx, time.Minute, key, `{"login":"octocat"}`))
+
+	_, err := store.GetResult(ctx, q)
+	assert.Equal(t, ErrResultNotFound, err)
+	assert.False(t, s.Exists(key))
+}
+
+func TestResultComplete(t *testing.T) {
+	users := []*github.User{{}, {}, {}}
+	assert.True(t, Result{Users: users, TotalCount: 50}.Complete(3))
+	assert.False(t, Result{Users: users, TotalCount: 50}.Complete(10))
+	// All the users of the location are stored
+	assert.True(t, Result{Users: users, TotalCount: 3}.Complete(10))
+	assert.False(t, Result{Users: users, TotalCount: 3, Failed: []string{"ghost"}}.Complete(10))
+	// Partial results are not complete even with enough users
+	partial := Result{Users: users, TotalCount: 50, Failed: []string{"ghost"}}
+	assert.False(t, partial.Complete(3))
+	assert.True(t, partial.Serves(3, true))
+	assert.False(t, partial.Serves(3, false))
+	assert.False(t, partial.Serves(10, true))
+	assert.True(t, Result{Users: users, TotalCount: 4, Failed: []string{"ghost"}}.Serves(10, true))
+}
+
+func TestResultStoreBoltBinaryCodec(t *testing.T) {
+	b, cleanup := newTestBoltCache(t)
+	defer cleanup()
+	codec, _ := NewCodec("msgpack+zstd")
+	store := NewResultStore(b, NewKeyBuilder("test"), codec)
+	q := Query{Location: "barcelona", Sort: "repos"}
+	assert.NoError(t, store.PutResult(ctx, time.Minute, Result{Query: q, Users: []*github.User{{Login: github.String("octocat")}}}))
+
+	got, err := store.GetResult(ctx, q)
+	assert.NoError(t, err)
+	assert.Equal(t, "octocat", got.Users[0].GetLogin())
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+//EnvPrefix is the prefix of the environment variables of the settings
+const EnvPrefix = "GHCONTRIB_"
+
+//FileSuffix is the suffix of the settings and environment variables that read a secret from a file
+const FileSuffix = "_file"
+
+//Redacted replaces the secret values when the settings are printed
+const Redacted = "********"
+
+//Source is where the value of a setting comes from
+type Source string
+
+//Sources of the settings, from the lowest to the highest precedence
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+//Setting is the effective value of a flag
+type Setting struct {
+	Name   string
+	Value  string
+	Type   string
+	Source Source
+	Secret bool
+}
+
+//Loader sets the flags that are not in the command line from the environment and a config file
+//The precedence is flags, GHCONTRIB_* environment variables, config file and defaults
+type Loader struct {
+	flags      *pflag.FlagSet
+	configFlag string
+	secrets    map[string]bool
+	sources    map[string]Source
+	// keys are the settings of the flags in a section, the other flags are set by their name
+	keys      map[string]string
+	sections  map[string]bool
+	lookupEnv func(string) (string, bool)
+}
+
+//NewLoader returns a Loader for the flags, configFlag is the flag with the path of the config file
+//The secrets are redacted when printed and can be read from a file with the _file suffix
+func NewLoader(flags *pflag.FlagSet, configFlag string, secrets []string) Loader {
+	l := Loader{
+		flags:      flags,
+		configFlag: configFlag,
+		secrets:    map[string]bool{},
+		sources:    map[string]Source{},
+		keys:       map[string]string{},
+		sections:   map[string]bool{},
+		lookupEnv:  os.LookupEnv,
+	}
+	for _, name := range secrets {
+		l.secrets[name] = true
+	}
+	return l
+}
+
+//Section puts flags under a section, their setting is the section and the flag name joined with _
+//so the flags of a subcommand do not take the values of the flags with the same name of another one.
+//The settings of a section without flags are ignored, they belong to another subcommand
+func (l Loader) Section(name string, flags *pflag.FlagSet) {
+	name = strings.ReplaceAll(name, "-", "_")
+	l.sections[name] = true
+	if flags == nil {
+		return
+	}
+	flags.VisitAll(func(f *pflag.Flag) {
+		l.keys[f.Name] = name + "_" + f.Name
+	})
+}
+
+//key returns the setting of a flag
+func (l Loader) key(name string) string {
+	if key, ok := l.keys[name]; ok {
+		return key
+	}
+	return name
+}
+
+//inSection checks if a setting belongs to a section
+func (l Loader) inSection(setting string) bool {
+	for name := range l.sections {
+		if strings.HasPrefix(setting, name+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+//EnvName returns the environment variable of a flag
+func EnvName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+//Load applies the environment variables and then the config file to the flags not set in the command line
+func (l Loader) Load() error {
+	var err error
+	flags := map[string]string{}
+	l.flags.VisitAll(func(f *pflag.Flag) {
+		flags[l.key(f.Name)] = f.Name
+		if err != nil {
+			return
+		}
+		l.sources[f.Name] = SourceDefault
+		if f.Changed {
+			l.sources[f.Name] = SourceFlag
+			return
+		}
+		value, ok, e := l.envValue(f.Name)
+		if e != nil {
+			err = e
+			return
+		}
+		if ok {
+			err = l.set(f.Name, value, SourceEnv)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	path := ""
+	if f := l.flags.Lookup(l.configFlag); f != nil {
+		path = f.Value.String()
+	}
+	if path == "" {
+		return nil
+	}
+	values, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := values[name]
+		if secret := strings.TrimSuffix(name, FileSuffix); secret != name && l.secrets[secret] {
+			if _, ok := values[secret]; ok {
+				return fmt.Errorf("%s: %s and %s are both set", path, secret, name)
+			}
+			if value, err = readSecret(value); err != nil {
+				return err
+			}
+			name = secret
+		}
+		flag, ok := flags[name]
+		if !ok || flag == l.configFlag {
+			if !l.inSection(name) {
+				logrus.WithField("path", path).Warnf("Unknown setting %q in the config file", name)
+			}
+			continue
+		}
+		if l.sources[flag] != SourceDefault {
+			continue
+		}
+		if err := l.set(flag, value, SourceFile); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+//envValue returns the value of a flag in the environment, secrets are also read from the file of the _FILE variable
+func (l Loader) envValue(name string) (string, bool, error) {
+	env := EnvName(l.key(name))
+	value, ok := l.lookupEnv(env)
+	if !l.secrets[name] {
+		return value, ok, nil
+	}
+	path, fromFile := l.lookupEnv(env + strings.ToUpper(FileSuffix))
+	if !fromFile {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("%s and %s are both set", env, env+strings.ToUpper(FileSuffix))
+	}
+	value, err := readSecret(path)
+	return value, err == nil, err
+}
+
+//set sets a flag and records its source
+func (l Loader) set(name string, value string, source Source) error {
+	if err := l.flags.Set(name, value); err != nil {
+		return fmt.Errorf("invalid value %q for %s: %v", value, name, err)
+	}
+	l.sources[name] = source
+	return nil
+}
+
+//Settings returns the effective value of the flags sorted by name, the secrets are redacted
+func (l Loader) Settings() []Setting {
+	var settings []Setting
+	l.flags.VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" {
+			return
+		}
+		source, ok := l.sources[f.Name]
+		if !ok {
+			source = SourceDefault
+			if f.Changed {
+				source = SourceFlag
+			}
+		}
+		s := Setting{Name: l.key(f.Name), Value: f.Value.String(), Type: f.Value.Type(), Source: source, Secret: l.secrets[f.Name]}
+		if s.Secret && s.Value != "" {
+			s.Value = Redacted
+		}
+		settings = append(settings, s)
+	})
+	return settings
+}
+
+//Write prints the settings as a YAML config file with the source of every value
+func (l Loader) Write(w io.Writer) error {
+	for _, s := range l.Settings() {
+		value := s.Value
+		switch s.Type {
+		case "bool", "int", "int64", "float64", "duration":
+		default:
+			out, err := yaml.Marshal(s.Value)
+			if err != nil {
+				return err
+			}
+			value = strings.TrimSuffix(string(out), "\n")
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s # %s\n", s.Name, value, s.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//readFile returns the settings of a YAML config file, nested sections are joined with _
+func readFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	values := map[string]string{}
+	if err := flatten("", doc, values); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+//flatten adds the values of a YAML section to values
+func flatten(prefix string, section map[string]interface{}, values map[string]string) error {
+	for key, v := range section {
+		name := strings.ReplaceAll(key, "-", "_")
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("%s is set twice", name)
+		}
+		switch v := v.(type) {
+		case map[interface{}]interface{}:
+			sub := make(map[string]interface{}, len(v))
+			for k, item := range v {
+				sub[fmt.Sprint(k)] = item
+			}
+			if err := flatten(name, sub, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+//readSecret returns the content of a secret file without the trailing newline
+func readSecret(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+//newFlags returns a flag set like the one of the command line
+func newFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("config", "", "")
+	flags.String("github_token", "", "")
+	flags.String("cache_backend", "redis", "")
+	flags.String("cache_addr", "localhost:6379", "")
+	flags.Int("cache_objttl", 300, "")
+	flags.Bool("verbose", false, "")
+	return flags
+}
+
+//newTestLoader returns a Loader with the environment of the test
+func newTestLoader(flags *pflag.FlagSet, env map[string]string) Loader {
+	l := NewLoader(flags, "config", []string{"github_token"})
+	l.lookupEnv = func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	return l
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", "cache:\n  backend: bolt\n  addr: file:6379\n  objttl: 60\nverbose: true\n")
+	flags := newFlags()
+	assert.NoError(t, flags.Parse([]string{"--config", path, "--cache_backend", "none"}))
+	l := newTestLoader(flags, map[string]string{"GHCONTRIB_CACHE_ADDR": "env:6379", "GHCONTRIB_CACHE_BACKEND": "redis"})
+	assert.NoError(t, l.Load())
+
+	values := map[string]Setting{}
+	for _, s := range l.Settings() {
+		values[s.Name] = s
+	}
+	assert.Equal(t, Setting{Name: "cache_backend", Value: "none", Type: "string", Source: SourceFlag}, values["cache_backend"])
+	assert.Equal(t, Setting{Name: "cache_addr", Value: "env:6379", Type: "string", Source: SourceEnv}, values["cache_addr"])
+	assert.Equal(t, Setting{Name: "cache_objttl", Value: "60", Type: "int", Source: SourceFile}, values["cache_objttl"])
+	assert.Equal(t, Setting{Name: "verbose", Value: "true", Type: "bool", Source: SourceFile}, values["verbose"])
+	assert.Equal(t, SourceDefault, values["github_token"].Source)
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	path := writeFile(t, "config.yaml", "cache_backend: bolt\nunknown: 1\n")
+	flags := newFlags()
+	l := newTestLoader(flags, map[string]string{"GHCONTRIB_CONFIG": path})
+	assert.NoError(t, l.Load())
+	backend, _ := flags.GetString("cache_backend")
+	assert.Equal(t, "bolt", backend)
+}
+
+func TestLoadSections(t *testing.T) {
+	path := writeFile(t, "config.yaml", "query:\n  output: json\ngenerate-site:\n  output: public\n  items: 50\noutput: ignored\n")
+	for _, tc := range []struct {
+		section string
+		env     map[string]string
+		want    string
+		source  Source
+	}{
+		{"query", nil, "json", SourceFile},
+		{"generate-site", nil, "public", SourceFile},
+		{"generate-site", map[string]string{"GHCONTRIB_GENERATE_SITE_OUTPUT": "dist", "GHCONTRIB_OUTPUT": "json"}, "dist", SourceEnv},
+		{"query", map[string]string{"GHCONTRIB_OUTPUT": "csv"}, "json", SourceFile},
+	} {
+		flags := newFlags()
+		local := pflag.NewFlagSet(tc.section, pflag.ContinueOnError)
+		local.String("output", "default", "")
+		flags.AddFlagSet(local)
+		env := map[string]string{"GHCONTRIB_CONFIG": path}
+		for k, v := range tc.env {
+			env[k] = v
+		}
+		l := newTestLoader(flags, env)
+		for _, section := range []string{"query", "generate-site"} {
+			if section == tc.section {
+				l.Section(section, local)
+			} else {
+				l.Section(section, nil)
+			}
+		}
+		assert.NoError(t, l.Load())
+		output, _ := flags.GetString("output")
+		assert.Equal(t, tc.want, output, tc.section)
+
+		settings := map[string]Setting{}
+		for _, s := range l.Settings() {
+			settings[s.Name] = s
+		}
+		key := strings.ReplaceAll(tc.section, "-", "_") + "_output"
+		assert.Equal(t, tc.source, settings[key].Source, tc.section)
+		assert.NotContains(t, settings, "output")
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	secret := writeFile(t, "token", "s3cret\n")
+
+	flags := newFlags()
+	l := newTestLoader(flags, map[string]string{"GHCONTRIB_GITHUB_TOKEN_FILE": secret})
+	assert.NoError(t, l.Load())
+	token, _ := flags.GetString("github_token")
+	assert.Equal(t, "s3cret", token)
+
+	flags = newFlags()
+	path := writeFile(t, "config.yaml", "github_token_file: "+secret+"\n")
+	l = newTestLoader(flags, map[string]string{"GHCONTRIB_CONFIG": path})
+	assert.NoError(t, l.Load())
+	token, _ = flags.GetString("github_token")
+	assert.Equal(t, "s3cret", token)
+
+	flags = newFlags()
+	l = newTestLoader(flags, map[string]string{"GHCONTRIB_GITHUB_TOKEN": "plain", "GHCONTRIB_GITHUB_TOKEN_FILE": secret})
+	assert.Error(t, l.Load())
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"invalid value": "cache_objttl: soon\n",
+		"set twice":     "cache_addr: a\ncache:\n  addr: b\n",
+		"invalid yaml":  "cache: [\n",
+	} {
+		flags := newFlags()
+		l := newTestLoader(flags, map[string]string{"GHCONTRIB_CONFIG": writeFile(t, "config.yaml", content)})
+		assert.Error(t, l.Load(), name)
+	}
+
+	flags := newFlags()
+	l := newTestLoader(flags, map[string]string{"GHCONTRIB_CONFIG": "/nonexistent/config.yaml"})
+	assert.Error(t, l.Load())
+}
+
+func TestWriteRedactsSecrets(t *testing.T) {
+	flags := newFlags()
+	assert.NoError(t, flags.Parse([]string{"--github_token", "s3cret"}))
+	l := newTestLoader(flags, map[string]string{"GHCONTRIB_CACHE_BACKEND": "bolt"})
+	assert.NoError(t, l.Load())
+
+	var b bytes.Buffer
+	assert.NoError(t, l.Write(&b))
+	assert.Equal(t, `cache_addr: localhost:6379 # default
+cache_backend: bolt # env
+cache_objttl: 300 # default
+config: "" # default
+github_token: '********' # flag
+verbose: false # default
+`, b.String())
+	assert.NotContains(t, b.String(), "s3cret")
+}
@@ -0,0 +1,155 @@
+package githubclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// JWTLifetime is the lifetime of the JWTs signed by the App, Github accepts up to 10 minutes
+	JWTLifetime = 9 * time.Minute
+	// JWTClockSkew is subtracted from the issue time of the JWTs to allow the clock of Github to be behind
+	JWTClockSkew = time.Minute
+	// TokenRefreshMargin is the time before its expiry an installation token is refreshed
+	TokenRefreshMargin = 5 * time.Minute
+)
+
+//AppCredentials authenticate a client as a Github App installation
+type AppCredentials struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKey     *rsa.PrivateKey
+}
+
+//LoadPrivateKey reads the PEM private key of a Github App
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(data)
+}
+
+//ParsePrivateKey parses a PKCS1 (as downloaded from Github) or PKCS8 PEM RSA private key
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("the private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the private key is not an RSA key")
+	}
+	return key, nil
+}
+
+//NewAppClient returns a github client authenticated as a Github App installation
+//The installation tokens are requested with a JWT signed by the App and refreshed before they expire
+func NewAppClient(ctx context.Context, creds AppCredentials, c cache.Cache, keys cache.KeyBuilder) (*Client, error) {
+	if creds.AppID == 0 || creds.InstallationID == 0 || creds.PrivateKey == nil {
+		return nil, errors.New("the Github App id, installation id and private key are required")
+	}
+	ts := newInstallationTokenSource(ctx, creds)
+	httpClient := &http.Client{Transport: &oauth2.Transport{Source: ts}}
+	return newClient(ctx, github.NewClient(httpClient), c, keys), nil
+}
+
+//jwtSource is a token source of JWTs signed by a Github App
+type jwtSource struct {
+	creds AppCredentials
+	now   func() time.Time
+}
+
+//Token returns a new JWT, they are cheap to sign so they are not reused
+func (s jwtSource) Token() (*oauth2.Token, error) {
+	jwt, expiry, err := signJWT(s.creds.AppID, s.creds.PrivateKey, s.now())
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: jwt, TokenType: "Bearer", Expiry: expiry}, nil
+}
+
+//signJWT returns an RS256 JWT issued by the App and its expiry
+func signJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, time.Time, error) {
+	issued := now.Add(-JWTClockSkew)
+	expiry := now.Add(JWTLifetime)
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", expiry, err
+	}
+	claims, err := json.Marshal(map[string]int64{"iat": issued.Unix(), "exp": expiry.Unix(), "iss": appID})
+	if err != nil {
+		return "", expiry, err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", expiry, err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), expiry, nil
+}
+
+//installationTokenSource is a token source of the installation tokens of a Github App
+//The token is reused until TokenRefreshMargin before its expiry
+type installationTokenSource struct {
+	ctx   context.Context
+	creds AppCredentials
+	apps  *github.Client
+	now   func() time.Time
+	mutex sync.Mutex
+	token *oauth2.Token
+}
+
+//newInstallationTokenSource returns the token source of an installation, the tokens are
+//requested to the Apps API authenticated with the JWTs of the App
+func newInstallationTokenSource(ctx context.Context, creds AppCredentials) *installationTokenSource {
+	jwts := jwtSource{creds: creds, now: time.Now}
+	apps := github.NewClient(&http.Client{Transport: &oauth2.Transport{Source: jwts}})
+	return &installationTokenSource{ctx: ctx, creds: creds, apps: apps, now: time.Now}
+}
+
+//Token returns the current installation token, or a new one if it is about to expire
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token != nil && s.now().Add(TokenRefreshMargin).Before(s.token.Expiry) {
+		return s.token, nil
+	}
+	token, _, err := s.apps.Apps.CreateInstallationToken(s.ctx, s.creds.InstallationID, nil)
+	if err != nil {
+		logrus.Error(err)
+		return nil, fmt.Errorf("failed to get the Github App installation token: %v", err)
+	}
+	s.token = &oauth2.Token{AccessToken: token.GetToken(), TokenType: "token", Expiry: token.GetExpiresAt()}
+	logrus.WithFields(logrus.Fields{
+		"installation": s.creds.InstallationID,
+		"expiry":       s.token.Expiry,
+	}).Debug("Github App installation token refreshed")
+	return s.token, nil
+}
@@ -0,0 +1,103 @@
+package githubclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	parsed, err := ParsePrivateKey(pkcs1)
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	parsed, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	_, err = ParsePrivateKey([]byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestSignJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	now := time.Unix(1600000000, 0)
+	jwt, expiry, err := signJWT(42, key, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(JWTLifetime), expiry)
+
+	parts := strings.Split(jwt, ".")
+	assert.Len(t, parts, 3)
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"iat": %d, "exp": %d, "iss": 42}`, now.Add(-JWTClockSkew).Unix(), expiry.Unix()), string(claims))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature))
+}
+
+func TestInstallationTokenRefresh(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	now := time.Now()
+	expiry := now.Add(time.Hour).UTC().Truncate(time.Second)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/app/installations/7/access_tokens", r.URL.Path)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "))
+		requests++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": fmt.Sprintf("token-%d", requests), "expires_at": expiry})
+	}))
+	defer server.Close()
+
+	ts := newInstallationTokenSource(context.Background(), AppCredentials{AppID: 42, InstallationID: 7, PrivateKey: key})
+	ts.apps.BaseURL, _ = url.Parse(server.URL + "/")
+	ts.now = func() time.Time { return now }
+
+	token, err := ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+	assert.True(t, expiry.Equal(token.Expiry))
+
+	token, err = ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	// The token is refreshed before it expires
+	now = expiry.Add(-TokenRefreshMargin)
+	token, err = ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+	assert.Equal(t, 2, requests)
+}
+
+func TestNewAppClientRequiresCredentials(t *testing.T) {
+	_, err := NewAppClient(context.Background(), AppCredentials{AppID: 42}, nil, cache.NewKeyBuilder("test"))
+	assert.Error(t, err)
+}
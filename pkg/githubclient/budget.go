@@ -0,0 +1,124 @@
+package githubclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+)
+
+//Rate limit resources of the Github API, every resource has its own bucket
+const (
+	ResourceCore   = "core"
+	ResourceSearch = "search"
+)
+
+//Bucket is the rate limit of a resource as reported by the last Github API response
+type Bucket struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	// Observed is the time of the last response, zero if the resource was not requested yet
+	Observed time.Time `json:"observed"`
+}
+
+//Known returns true if the bucket was reported by a response
+func (b Bucket) Known() bool {
+	return b.Limit > 0
+}
+
+//RateLimits are the buckets of the resources requested by the client
+type RateLimits struct {
+	Core   Bucket `json:"core"`
+	Search Bucket `json:"search"`
+}
+
+//Cost is the number of requests of each resource needed by an operation
+type Cost struct {
+	Search int
+	Core   int
+}
+
+//SearchCost returns the cost of a search of items users, a search request and a Users API
+//request per user. Users not modified since the last lookup do not count, so it is an upper bound
+func SearchCost(items int) Cost {
+	return Cost{Search: 1, Core: items}
+}
+
+//BudgetError is returned when an operation does not fit in the remaining rate limit of a resource
+type BudgetError struct {
+	Resource  string
+	Needed    int
+	Remaining int
+	Reset     time.Time
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("Github %s rate limit budget exceeded: %d requests needed, %d remaining until %s",
+		e.Resource, e.Needed, e.Remaining, e.Reset.Format(time.RFC3339))
+}
+
+//rateTracker keeps the buckets of the resources from the responses
+type rateTracker struct {
+	mutex   sync.Mutex
+	buckets map[string]Bucket
+	now     func() time.Time
+}
+
+//newRateTracker returns a rateTracker without known buckets
+func newRateTracker() *rateTracker {
+	return &rateTracker{buckets: map[string]Bucket{}, now: time.Now}
+}
+
+//observe updates the bucket of a resource with the rate of a response
+//Concurrent responses arrive out of order, so in the same window the lowest remaining is kept
+func (t *rateTracker) observe(resource string, rate github.Rate) {
+	if rate.Limit == 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	b := t.buckets[resource]
+	reset := rate.Reset.Time
+	if b.Reset.Equal(reset) && b.Remaining < rate.Remaining {
+		b.Observed = t.now()
+		t.buckets[resource] = b
+		return
+	}
+	t.buckets[resource] = Bucket{Limit: rate.Limit, Remaining: rate.Remaining, Reset: reset, Observed: t.now()}
+}
+
+//bucket returns the bucket of a resource, refilled if its window was reset
+func (t *rateTracker) bucket(resource string) Bucket {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	b := t.buckets[resource]
+	if b.Known() && !t.now().Before(b.Reset) {
+		b.Remaining = b.Limit
+	}
+	return b
+}
+
+//fits checks if needed requests of a resource fit in its bucket, unknown buckets are not checked
+func (t *rateTracker) fits(resource string, needed int) error {
+	b := t.bucket(resource)
+	if !b.Known() || needed <= b.Remaining {
+		return nil
+	}
+	return &BudgetError{Resource: resource, Needed: needed, Remaining: b.Remaining, Reset: b.Reset}
+}
+
+//RateLimits returns the rate limits of the Github API seen by the client
+func (gh *Client) RateLimits() RateLimits {
+	return RateLimits{Core: gh.rates.bucket(ResourceCore), Search: gh.rates.bucket(ResourceSearch)}
+}
+
+//Forecast checks if an operation fits in the remaining rate limits before starting it,
+//so it is rejected early instead of failing halfway
+func (gh *Client) Forecast(cost Cost) error {
+	if err := gh.rates.fits(ResourceSearch, cost.Search); err != nil {
+		return err
+	}
+	return gh.rates.fits(ResourceCore, cost.Core)
+}
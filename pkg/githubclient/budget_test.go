@@ -0,0 +1,68 @@
+package githubclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func rate(limit int, remaining int, reset time.Time) github.Rate {
+	return github.Rate{Limit: limit, Remaining: remaining, Reset: github.Timestamp{Time: reset}}
+}
+
+func TestRateTrackerKeepsLowestRemaining(t *testing.T) {
+	tr := newRateTracker()
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	tr.observe(ResourceCore, rate(5000, 4990, reset))
+	tr.observe(ResourceCore, rate(5000, 4992, reset))
+	assert.Equal(t, 4990, tr.bucket(ResourceCore).Remaining)
+
+	// A new window replaces the bucket
+	next := reset.Add(time.Hour)
+	tr.observe(ResourceCore, rate(5000, 4999, next))
+	assert.Equal(t, 4999, tr.bucket(ResourceCore).Remaining)
+
+	// Responses without rate headers are ignored
+	tr.observe(ResourceCore, github.Rate{})
+	assert.Equal(t, 4999, tr.bucket(ResourceCore).Remaining)
+	assert.False(t, tr.bucket(ResourceSearch).Known())
+}
+
+func TestRateTrackerRefillsAfterReset(t *testing.T) {
+	tr := newRateTracker()
+	now := time.Now()
+	tr.now = func() time.Time { return now }
+	tr.observe(ResourceSearch, rate(30, 0, now.Add(time.Minute)))
+	assert.Error(t, tr.fits(ResourceSearch, 1))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, 30, tr.bucket(ResourceSearch).Remaining)
+	assert.NoError(t, tr.fits(ResourceSearch, 1))
+}
+
+func TestForecast(t *testing.T) {
+	gh := NewClient(context.Background(), "", nil, cache.NewKeyBuilder("test"))
+	// Unknown buckets do not reject operations
+	assert.NoError(t, gh.Forecast(SearchCost(100)))
+
+	reset := time.Now().Add(time.Hour)
+	gh.rates.observe(ResourceSearch, rate(30, 10, reset))
+	gh.rates.observe(ResourceCore, rate(5000, 50, reset))
+	assert.NoError(t, gh.Forecast(SearchCost(50)))
+
+	err := gh.Forecast(SearchCost(51))
+	assert.Equal(t, &BudgetError{Resource: ResourceCore, Needed: 51, Remaining: 50, Reset: reset}, err)
+
+	gh.rates.observe(ResourceSearch, rate(30, 0, reset))
+	err = gh.Forecast(SearchCost(1))
+	assert.IsType(t, &BudgetError{}, err)
+	assert.Equal(t, ResourceSearch, err.(*BudgetError).Resource)
+
+	limits := gh.RateLimits()
+	assert.Equal(t, 0, limits.Search.Remaining)
+	assert.Equal(t, 50, limits.Core.Remaining)
+}
@@ -0,0 +1,119 @@
+package githubclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultWorkers is the default number of concurrent Users API requests
+	DefaultWorkers = 5
+	// Responses slower than slowResponse halve the concurrency
+	slowResponse = 2 * time.Second
+)
+
+//limiter is a semaphore shared by all the getUsersWorkers of a Client
+//Its limit adapts to the remaining Github quota and to the observed latency,
+//so concurrent requests to the API do not multiply the load on Github
+type limiter struct {
+	mu       sync.Mutex
+	max      int
+	limit    int
+	inFlight int
+	released chan struct{}
+}
+
+//newLimiter returns a limiter allowing up to max concurrent requests
+func newLimiter(max int) *limiter {
+	if max < 1 {
+		max = 1
+	}
+	return &limiter{
+		max:      max,
+		limit:    max,
+		released: make(chan struct{}),
+	}
+}
+
+//acquire waits for a free slot or for the context to be canceled
+func (l *limiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		wait := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+//release frees a slot and wakes up the waiting workers
+func (l *limiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+//broadcast must be called with the mutex held
+func (l *limiter) broadcast() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+//observe adapts the limit after a response. The limit is capped proportionally to the
+//remaining quota, halved on slow responses and increased by one otherwise
+func (l *limiter) observe(rate github.Rate, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	budget := l.max
+	if rate.Limit > 0 {
+		budget = l.max * rate.Remaining / rate.Limit
+	}
+	if budget < 1 {
+		budget = 1
+	}
+
+	limit := l.limit
+	if latency > slowResponse {
+		limit = limit / 2
+	} else {
+		limit++
+	}
+	if limit > budget {
+		limit = budget
+	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	if limit != l.limit {
+		logrus.WithFields(logrus.Fields{
+			"limit":     limit,
+			"remaining": rate.Remaining,
+			"latency":   latency,
+		}).Debug("Adapting Github API concurrency")
+	}
+	if limit > l.limit {
+		l.broadcast()
+	}
+	l.limit = limit
+}
+
+//SetWorkers sets the maximum number of concurrent Users API requests of the client
+func (gh *Client) SetWorkers(workers int) {
+	gh.limiter = newLimiter(workers)
+}
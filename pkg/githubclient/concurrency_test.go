@@ -0,0 +1,40 @@
+package githubclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterBlocksOverLimit(t *testing.T) {
+	l := newLimiter(1)
+	assert.NoError(t, l.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, l.acquire(ctx))
+
+	l.release()
+	assert.NoError(t, l.acquire(context.Background()))
+}
+
+func TestLimiterAdaptsToRemainingQuota(t *testing.T) {
+	l := newLimiter(10)
+	l.observe(github.Rate{Limit: 5000, Remaining: 1000}, time.Millisecond)
+	assert.Equal(t, 2, l.limit)
+
+	l.observe(github.Rate{Limit: 5000, Remaining: 1}, time.Millisecond)
+	assert.Equal(t, 1, l.limit)
+}
+
+func TestLimiterAdaptsToLatency(t *testing.T) {
+	l := newLimiter(8)
+	l.observe(github.Rate{Limit: 5000, Remaining: 5000}, 3*time.Second)
+	assert.Equal(t, 4, l.limit)
+
+	l.observe(github.Rate{Limit: 5000, Remaining: 5000}, time.Millisecond)
+	assert.Equal(t, 5, l.limit)
+}
@@ -0,0 +1,135 @@
+package githubclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+)
+
+// ValidatorsTTL is the time the ETag/Last-Modified validators are kept in the cache
+const ValidatorsTTL = 24 * time.Hour
+
+//validators holds the conditional request headers returned by github along with the response body
+type validators struct {
+	ETag         string          `json:"etag"`
+	LastModified string          `json:"last_modified"`
+	Body         json.RawMessage `json:"body"`
+}
+
+//getValidators gets the stored validators for a key, returns nil if there are not validators
+func (gh *Client) getValidators(ctx context.Context, key string) *validators {
+	if gh.cache == nil {
+		return nil
+	}
+	value, err := gh.cache.GetKey(ctx, key)
+	if err != nil {
+		return nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	var v validators
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		logrus.WithField("key", key).Debug("Discarding corrupt validators from the cache")
+		return nil
+	}
+	return &v
+}
+
+//setValidators stores the validators of a response and its body in the cache
+func (gh *Client) setValidators(ctx context.Context, key string, resp *github.Response, body interface{}) {
+	if gh.cache == nil || resp == nil {
+		return
+	}
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	gh.storeValidators(ctx, key, validators{ETag: etag, LastModified: lastModified, Body: b})
+}
+
+//storeValidators stores validators in the cache for ValidatorsTTL
+func (gh *Client) storeValidators(ctx context.Context, key string, v validators) {
+	s, _ := json.Marshal(v)
+	if err := gh.cache.SetKey(ctx, ValidatorsTTL, key, string(s)); err != nil {
+		logrus.WithField("key", key).Debug("Error storing validators in the cache")
+	}
+}
+
+//doConditional issues a GET request sending If-None-Match/If-Modified-Since when validators
+//for the key are cached. On a 304 Not Modified response the cached body is decoded into v,
+//GitHub does not count these responses against the rate limit. The validators TTL is renewed
+//on every response so resources that do not change keep being requested conditionally
+func (gh *Client) doConditional(ctx context.Context, key string, u string, v interface{}) (*github.Response, error) {
+	cached := gh.getValidators(ctx, key)
+	resp, err := gh.withRetry(ctx, func() (*github.Response, error) {
+		req, err := gh.clientRest.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if cached != nil {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+		return gh.clientRest.Do(ctx, req, v)
+	})
+	if resp != nil && resp.StatusCode == http.StatusNotModified && cached != nil {
+		logrus.WithField("key", key).Debug("Github API returned Not Modified, using cached body")
+		if err := json.Unmarshal(cached.Body, v); err != nil {
+			return resp, err
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			cached.ETag = etag
+		}
+		gh.storeValidators(ctx, key, *cached)
+		return resp, nil
+	} else if err != nil {
+		return resp, err
+	}
+	gh.setValidators(ctx, key, resp, v)
+	return resp, nil
+}
+
+//getUser gets the details of a user using a conditional request
+func (gh *Client) getUser(ctx context.Context, user string) (*github.User, *github.Response, error) {
+	var u github.User
+	resp, err := gh.doConditional(ctx, gh.keys.Validators("user", strings.ToLower(user)), "users/"+url.PathEscape(user), &u)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &u, resp, nil
+}
+
+//searchUsers performs a search users request using a conditional request
+func (gh *Client) searchUsers(ctx context.Context, query string, opts *github.SearchOptions) (*github.UsersSearchResult, *github.Response, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("sort", opts.Sort)
+	params.Set("page", strconv.Itoa(opts.Page))
+	params.Set("per_page", strconv.Itoa(opts.PerPage))
+	u := "search/users?" + params.Encode()
+
+	var result github.UsersSearchResult
+	resp, err := gh.doConditional(ctx, gh.keys.Validators("search", strings.ToLower(params.Encode())), u, &result)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &result, resp, nil
+}
@@ -0,0 +1,67 @@
+package githubclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	ctx := context.Background()
+	c, err := cache.NewBoltCache(filepath.Join(t.TempDir(), "cache.db"), cache.DefaultLockOptions())
+	assert.NoError(t, err)
+	defer c.Close()
+	keys := cache.NewKeyBuilder("test")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/users/octocat", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"login": "octocat", "public_repos": 8}`))
+	}))
+	defer server.Close()
+
+	gh := NewClient(ctx, "", c, keys)
+	gh.clientRest.BaseURL, _ = url.Parse(server.URL + "/")
+	gh.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	u, resp, err := gh.getUser(ctx, "octocat")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 8, u.GetPublicRepos())
+	key := keys.Validators("user", "octocat")
+	v := gh.getValidators(ctx, key)
+	assert.NotNil(t, v)
+	assert.Equal(t, `"v1"`, v.ETag)
+
+	// The validators are about to expire, the 304 renews them
+	assert.NoError(t, c.SetKey(ctx, time.Minute, key, mustGetKey(t, c, key)))
+	u, resp, err = gh.getUser(ctx, "octocat")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, "octocat", u.GetLogin())
+	assert.Equal(t, 8, u.GetPublicRepos())
+	ttl, err := c.TTL(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, ttl > time.Hour)
+	assert.Equal(t, 2, requests)
+}
+
+func mustGetKey(t *testing.T, c cache.Cache, key string) string {
+	value, err := c.GetKey(context.Background(), key)
+	assert.NoError(t, err)
+	return value.(string)
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 )
@@ -16,12 +19,18 @@ import (
 type Client struct {
 	ctx            context.Context
 	clientRest     *github.Client
+	cache          cache.Cache
+	keys           cache.KeyBuilder
+	retryPolicy    RetryPolicy
+	limiter        *limiter
+	rates          *rateTracker
 	rateLimitError *github.RateLimitError
 	rateLimitMutex sync.Mutex
 }
 
 //NewClient returns a github client
-func NewClient(ctx context.Context, token string) *Client {
+//If a cache is provided, it is used to store the validators for conditional requests
+func NewClient(ctx context.Context, token string, c cache.Cache, keys cache.KeyBuilder) *Client {
 	var clientRest *github.Client
 	if token != "" {
 		ts := oauth2.StaticTokenSource(
@@ -33,13 +42,27 @@ func NewClient(ctx context.Context, token string) *Client {
 		clientRest = github.NewClient(nil)
 
 	}
+	return newClient(ctx, clientRest, c, keys)
+}
 
+//newClient returns a client using an authenticated Github API client
+func newClient(ctx context.Context, clientRest *github.Client, c cache.Cache, keys cache.KeyBuilder) *Client {
 	return &Client{
-		ctx:        ctx,
-		clientRest: clientRest,
+		ctx:         ctx,
+		clientRest:  clientRest,
+		cache:       c,
+		keys:        keys,
+		retryPolicy: DefaultRetryPolicy(),
+		limiter:     newLimiter(DefaultWorkers),
+		rates:       newRateTracker(),
 	}
 }
 
+//SetRetryPolicy sets the policy used to retry failed Github API requests
+func (gh *Client) SetRetryPolicy(p RetryPolicy) {
+	gh.retryPolicy = p
+}
+
 //Checks if a Github API RateLimit is Active
 func (gh *Client) CheckRateLimit() bool {
 	if gh.rateLimitError != nil {
@@ -63,92 +86,178 @@ func (gh *Client) setRateLimit(err *github.RateLimitError) {
 }
 
 //GetRateLimitError Returns the Rate limit error
-func (gh Client) GetRateLimitError() error {
+func (gh *Client) GetRateLimitError() error {
 	return gh.rateLimitError
 }
 
+//SearchResult is the result of GetUsersByLocation
+type SearchResult struct {
+	Users []*github.User
+	// Failed are the logins whose details could not be fetched
+	Failed []string
+	// TotalCount is the number of users in the location
+	TotalCount int
+}
+
+//Sorts are the sorts of the Search API accepted in the queries
+var Sorts = []string{"repos", "followers", "joined"}
+
+//Qualifiers are the search qualifiers accepted as filters of the queries
+var Qualifiers = []string{"language", "followers", "repos", "created"}
+
+//ValidateQuery checks the sort and the filters of a query
+func ValidateQuery(q cache.Query) error {
+	if !contains(Sorts, q.Sort) {
+		return fmt.Errorf("unknown sort %q, valid sorts are %s", q.Sort, strings.Join(Sorts, ", "))
+	}
+	for name := range q.Filters {
+		if !contains(Qualifiers, name) {
+			return fmt.Errorf("unknown filter %q, valid filters are %s", name, strings.Join(Qualifiers, ", "))
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+//searchQuery returns the Search API query of a users query, filters are sorted to get stable queries
+func searchQuery(q cache.Query) string {
+	// The location is quoted so the words after the first one are not searched as keywords
+	parts := []string{`location:"` + strings.ReplaceAll(q.Location, `"`, "") + `"`, "type:user"}
+	names := make([]string, 0, len(q.Filters))
+	for name := range q.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name+":"+q.Filters[name])
+	}
+	return strings.Join(parts, " ")
+}
+
 //GetUsersByLocation performs a Search API request to find all users by the paramter location
 //Then runs the getUserDispatcher function to get all user details concurrently
-func (gh *Client) GetUsersByLocation(ctx context.Context, location string, items int) ([]*github.User, error) {
+//If partial is true, users whose details could not be fetched are skipped and their logins returned
+//in Failed instead of aborting the whole request
+func (gh *Client) GetUsersByLocation(ctx context.Context, location string, items int, partial bool) (SearchResult, error) {
+	return gh.SearchUsers(ctx, cache.Query{Location: location, Sort: "repos"}, items, partial)
+}
+
+//SearchUsers gets the users of a query with their details, like GetUsersByLocation
+//The filters of the query are added to the search as qualifiers
+func (gh *Client) SearchUsers(ctx context.Context, query cache.Query, items int, partial bool) (SearchResult, error) {
 	// Control Rate Limit
 	if ok := gh.CheckRateLimit(); ok {
 		logrus.Debug("RateLimitError Set, Discarting API Requests until RateLimit expiration")
 		logrus.Error(gh.rateLimitError)
-		return nil, gh.rateLimitError
+		return SearchResult{}, gh.rateLimitError
 	} else {
 		gh.setRateLimit(nil)
 	}
+	if err := gh.Forecast(SearchCost(items)); err != nil {
+		logrus.Error(err)
+		return SearchResult{}, err
+	}
 
 	var users = make([]*github.User, 0)
-	opts := &github.SearchOptions{ListOptions: github.ListOptions{Page: 1, PerPage: items}, Sort: "repos"}
-	q := fmt.Sprintf("location:%s type:user", location)
+	var failed []string
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{Page: 1, PerPage: items}, Sort: query.Sort}
+	q := searchQuery(query)
 
 	logrus.Debug("Invoking Github Search API")
-	result, resp, err := gh.clientRest.Search.Users(gh.ctx, q, opts)
+	result, resp, err := gh.searchUsers(ctx, q, opts)
+	if resp != nil {
+		gh.rates.observe(ResourceSearch, resp.Rate)
+	}
 
 	if _, ok := err.(*github.RateLimitError); ok {
 		logrus.Error(err)
 		gh.setRateLimit(err.(*github.RateLimitError))
-		return nil, err
+		return SearchResult{}, err
 	} else if err != nil {
 		logrus.Error(err)
-		return nil, err
+		return SearchResult{}, err
 	}
 
 	logrus.WithFields(logrus.Fields{
 		"pages":         resp.LastPage,
 		"nextPage":      resp.NextPage,
 		"returnedUsers": len(result.Users),
-		"location":      location,
+		"query":         q,
 		"Limit":         resp.Rate.Limit,
 		"Remaining":     resp.Rate.Remaining,
 		"Reset":         resp.Rate.Reset,
 	}).Debug("Github Search API Response")
 
 	if len(result.Users) > 0 {
-		users, err = gh.getUsersDispatcher(ctx, result.Users)
+		users, failed, err = gh.getUsersDispatcher(ctx, result.Users, partial)
 		if _, ok := err.(*github.RateLimitError); ok {
 			logrus.Error(err)
 			gh.setRateLimit(err.(*github.RateLimitError))
-			return nil, err
+			return SearchResult{}, err
 		} else if err != nil {
-			return nil, err
+			return SearchResult{}, err
 		}
 	}
-	return users, nil
+	return SearchResult{Users: users, Failed: failed, TotalCount: result.GetTotal()}, nil
+}
+
+//userError is the error returned by a getUsersWorker for a user
+type userError struct {
+	login string
+	err   error
 }
 
 //Manages the logic of the getUserWorkers and returns the final result slice with all the user details.
-func (gh *Client) getUsersDispatcher(ctx context.Context, users []*github.User) ([]*github.User, error) {
+//When partial is true only RateLimit errors abort, the logins of the failed users are returned
+func (gh *Client) getUsersDispatcher(ctx context.Context, users []*github.User, partial bool) ([]*github.User, []string, error) {
 	select {
 	case <-ctx.Done():
-		return nil, errors.New("getUsersDispatcher Context canceled")
+		return nil, nil, errors.New("getUsersDispatcher Context canceled")
 	default:
 		var queue = make(chan string)
-		var errors = make(chan error, 1)
+		var errors = make(chan userError)
 		var done = make(chan bool, 1)
 		var results = make(chan *github.User)
 		var wg sync.WaitGroup
 
 		// Ctx withCancel to cancel goroutines if needed
 		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
 
-		// Launch some workers
-		// Be careful with RateLimit
-		for i := 0; i < 5; i++ {
+		// Launch some workers, the client limiter bounds how many of them
+		// (from all the running dispatchers) are requesting the API at the same time
+		workers := gh.limiter.max
+		if len(users) < workers {
+			workers = len(users)
+		}
+		for i := 0; i < workers; i++ {
 			wg.Add(1)
 			go gh.getUsersWorker(ctx, queue, results, errors, &wg)
 		}
 
 		// Enqueue users to get the details on the queue channel
 		go func() {
+			defer close(queue)
 			for _, u := range users {
 				logrus.WithFields(logrus.Fields{
 					"user": *(u).Login,
 				}).Debug("getUsersDispatcher Send user to process queue")
-				queue <- *(u).Login
+				select {
+				case <-ctx.Done():
+					return
+				case queue <- *(u).Login:
+				}
 			}
-			close(queue)
+		}()
+		go func() {
 			wg.Wait()
 			// Send a bool the the done channel to notify all work is done
 			done <- true
@@ -156,15 +265,19 @@ func (gh *Client) getUsersDispatcher(ctx context.Context, users []*github.User)
 
 		// Get the results or error from a the goroutines
 		var users []*github.User
+		var failed []string
 		for {
 			select {
 			case <-done:
-				cancel()
-				return users, nil
+				return users, failed, nil
 			case e := <-errors:
+				if _, ok := e.err.(*github.RateLimitError); partial && !ok {
+					logrus.WithField("user", e.login).Debug("getUsersDispatcher Skipping failed user")
+					failed = append(failed, e.login)
+					continue
+				}
 				// If a goroutine returns an error cancel the context and return the error retourned
-				cancel()
-				return nil, e
+				return nil, nil, e.err
 			case r := <-results:
 				// Add a result to the results slice
 				users = append(users, r)
@@ -175,12 +288,13 @@ func (gh *Client) getUsersDispatcher(ctx context.Context, users []*github.User)
 
 //Function runs as a goroutine concurrently to get the user details (number of repos)
 //Sincronization is made with channels
-func (gh *Client) getUsersWorker(ctx context.Context, queue <-chan string, results chan *github.User, errors chan<- error, wg *sync.WaitGroup) {
+func (gh *Client) getUsersWorker(ctx context.Context, queue <-chan string, results chan<- *github.User, errors chan<- userError, wg *sync.WaitGroup) {
 	defer func() { logrus.Debug("getUsersWorker finished"); wg.Done() }()
 	for {
 		select {
 		case <-ctx.Done():
 			logrus.Debug("getUsersWorker Context canceled")
+			return
 		case user, ok := <-queue:
 			if !ok {
 				logrus.Debug("getUsersWorker queue channel closed, terminating")
@@ -189,24 +303,38 @@ func (gh *Client) getUsersWorker(ctx context.Context, queue <-chan string, resul
 			logrus.WithFields(logrus.Fields{
 				"user": user,
 			}).Debug("getUsersWorker Invoking Github Users API")
-			userDetails, resp, err := gh.clientRest.Users.Get(ctx, user)
+			if err := gh.limiter.acquire(ctx); err != nil {
+				logrus.Debug("getUsersWorker Context canceled")
+				return
+			}
+			start := time.Now()
+			userDetails, resp, err := gh.getUser(ctx, user)
+			gh.limiter.release()
+			if resp != nil {
+				gh.limiter.observe(resp.Rate, time.Since(start))
+				gh.rates.observe(ResourceCore, resp.Rate)
+			}
 			if err != nil {
 				logrus.Error(err)
-				// This will trigger Cancel in the dispatcher
-				// A Retry could be issued here depending on the error returned
-				errors <- err
+				// Transient errors are already retried by getUser
+				// The dispatcher decides if the error cancels the other workers
+				select {
+				case <-ctx.Done():
+					return
+				case errors <- userError{login: user, err: err}:
+				}
+				continue
 			}
+			logrus.WithFields(logrus.Fields{
+				"Limit":     resp.Rate.Limit,
+				"Remaining": resp.Rate.Remaining,
+				"Reset":     resp.Rate.Reset,
+			}).Debug("getUsersWorker Github RateLimit")
 			select {
 			case <-ctx.Done():
 				logrus.Debug("getUsersWorker Context canceled")
 				return
-			default:
-				logrus.WithFields(logrus.Fields{
-					"Limit":     resp.Rate.Limit,
-					"Remaining": resp.Rate.Remaining,
-					"Reset":     resp.Rate.Reset,
-				}).Debug("getUsersWorker Github RateLimit")
-				results <- userDetails
+			case results <- userDetails:
 			}
 		}
 	}
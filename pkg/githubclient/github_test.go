@@ -0,0 +1,25 @@
+package githubclient
+
+import (
+	"testing"
+
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchQuery(t *testing.T) {
+	q := cache.Query{Location: "barcelona", Sort: "followers", Filters: map[string]string{"repos": ">10", "language": "go"}}
+	assert.Equal(t, `location:"barcelona" type:user language:go repos:>10`, searchQuery(q))
+	assert.Equal(t, `location:"barcelona" type:user`, searchQuery(cache.Query{Location: "barcelona"}))
+}
+
+func TestSearchQueryMultiWordLocation(t *testing.T) {
+	assert.Equal(t, `location:"new york" type:user`, searchQuery(cache.Query{Location: "new york"}))
+	assert.Equal(t, `location:"new york" type:user`, searchQuery(cache.Query{Location: `new "york"`}))
+}
+
+func TestValidateQuery(t *testing.T) {
+	assert.NoError(t, ValidateQuery(cache.Query{Location: "barcelona", Sort: "repos", Filters: map[string]string{"language": "go"}}))
+	assert.Error(t, ValidateQuery(cache.Query{Location: "barcelona", Sort: "stars"}))
+	assert.Error(t, ValidateQuery(cache.Query{Location: "barcelona", Sort: "repos", Filters: map[string]string{"location": "madrid"}}))
+}
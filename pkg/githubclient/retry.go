@@ -0,0 +1,117 @@
+package githubclient
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/sirupsen/logrus"
+)
+
+//RetryPolicy defines how failed Github API requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts for a request, 1 disables retries
+	MaxAttempts int
+	// BaseDelay is the initial backoff, it is doubled on every attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff. A Retry-After longer than MaxDelay is not retried
+	MaxDelay time.Duration
+}
+
+//DefaultRetryPolicy returns the RetryPolicy used when none is set
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+	}
+}
+
+//backoff returns a jittered exponential delay for an attempt (starting at 1)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Full jitter, spreads the retries of concurrent workers
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+//shouldRetry decides if a failed request can be retried and how long to wait before doing it
+//A zero wait means the backoff of the policy has to be used
+func (p RetryPolicy) shouldRetry(resp *github.Response, err error) (time.Duration, bool) {
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		// Primary rate limit, nothing to do until the reset
+		return 0, false
+	case *github.AbuseRateLimitError:
+		// Secondary rate limit
+		if e.RetryAfter != nil {
+			return *e.RetryAfter, *e.RetryAfter <= p.MaxDelay
+		}
+		return 0, true
+	}
+
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return 0, false
+	}
+	if resp == nil || resp.Response == nil {
+		// Network errors
+		return 0, true
+	}
+	if wait := retryAfter(resp.Response); wait > 0 {
+		return wait, wait <= p.MaxDelay
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return 0, true
+	}
+	return 0, resp.StatusCode >= http.StatusInternalServerError
+}
+
+//retryAfter parses the Retry-After header, it only supports the seconds format
+func retryAfter(r *http.Response) time.Duration {
+	v := r.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+//withRetry runs fn until it succeeds, the error is not retryable or the attempts are exhausted
+func (gh *Client) withRetry(ctx context.Context, fn func() (*github.Response, error)) (*github.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := fn()
+		if err == nil {
+			return resp, nil
+		}
+		wait, ok := gh.retryPolicy.shouldRetry(resp, err)
+		if !ok || attempt >= gh.retryPolicy.MaxAttempts {
+			return resp, err
+		}
+		if wait == 0 {
+			wait = gh.retryPolicy.backoff(attempt)
+		}
+		logrus.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"wait":    wait,
+			"error":   err,
+		}).Debug("Retrying Github API request")
+
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package githubclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func response(status int, header http.Header) *github.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &github.Response{Response: &http.Response{StatusCode: status, Header: header}}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+	for attempt := 1; attempt <= 10; attempt++ {
+		assert.True(t, p.backoff(attempt) < p.MaxDelay)
+	}
+}
+
+func TestShouldRetryServerErrors(t *testing.T) {
+	p := DefaultRetryPolicy()
+	_, ok := p.shouldRetry(response(http.StatusBadGateway, nil), errors.New("bad gateway"))
+	assert.True(t, ok)
+	_, ok = p.shouldRetry(nil, errors.New("connection reset"))
+	assert.True(t, ok)
+}
+
+func TestShouldNotRetryClientErrors(t *testing.T) {
+	p := DefaultRetryPolicy()
+	_, ok := p.shouldRetry(response(http.StatusNotFound, nil), errors.New("not found"))
+	assert.False(t, ok)
+	_, ok = p.shouldRetry(response(http.StatusForbidden, nil), &github.RateLimitError{})
+	assert.False(t, ok)
+}
+
+func TestShouldRetryHonorsRetryAfter(t *testing.T) {
+	p := DefaultRetryPolicy()
+	retryAfter := 2 * time.Second
+	wait, ok := p.shouldRetry(response(http.StatusForbidden, nil), &github.AbuseRateLimitError{RetryAfter: &retryAfter})
+	assert.True(t, ok)
+	assert.Equal(t, retryAfter, wait)
+
+	wait, ok = p.shouldRetry(response(http.StatusServiceUnavailable, http.Header{"Retry-After": []string{"3"}}), errors.New("unavailable"))
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, wait)
+
+	_, ok = p.shouldRetry(response(http.StatusServiceUnavailable, http.Header{"Retry-After": []string{"3600"}}), errors.New("unavailable"))
+	assert.False(t, ok)
+}
+
+func TestSearchUsersRetriesAreBoundToTheContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	gh := NewClient(context.Background(), "", cache.NopCache{}, cache.NewKeyBuilder("test"))
+	gh.clientRest.BaseURL, _ = url.Parse(server.URL + "/")
+	gh.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := gh.SearchUsers(ctx, cache.Query{Location: "barcelona", Sort: "repos"}, 10, false)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+)
+
+//SweepInterval is the time between the removal of the idle local buckets
+const SweepInterval = time.Minute
+
+//Decision is the result of taking a token from a bucket
+type Decision struct {
+	Allowed bool
+	// Remaining are the whole tokens left in the bucket
+	Remaining int64
+	// RetryAfter is the time until the next token when the request is not allowed
+	RetryAfter time.Duration
+}
+
+//Limiter is a token bucket per client
+type Limiter interface {
+	Allow(ctx context.Context, client string) (Decision, error)
+}
+
+//Options configures a Limiter
+type Options struct {
+	// Name identifies the limiter, every limiter has its own buckets
+	Name string
+	// Rate is the number of tokens added to the buckets per second
+	Rate float64
+	// Burst is the capacity of the buckets
+	Burst int64
+}
+
+//evaler is implemented by the caches that run Lua scripts
+type evaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+//New returns a Limiter distributed through the cache if it runs scripts,
+//otherwise the buckets are local to every replica
+func New(c cache.Cache, keys cache.KeyBuilder, opts Options) Limiter {
+	if e, ok := c.(evaler); ok {
+		return &redisLimiter{eval: e, keys: keys, opts: opts, now: time.Now}
+	}
+	return NewLocal(opts)
+}
+
+//retryAfter returns the time until a bucket has a whole token
+func (o Options) retryAfter(tokens float64) time.Duration {
+	return time.Duration((1 - tokens) / o.Rate * float64(time.Second))
+}
+
+//ttl returns the time a bucket takes to be full again, it can be dropped after that
+func (o Options) ttl() time.Duration {
+	return time.Duration(float64(o.Burst)/o.Rate*float64(time.Second)) + time.Second
+}
+
+//bucketScript refills the bucket with the elapsed time and takes a token
+//The state of the bucket is the tokens left and the time of the last request in milliseconds
+const bucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return {allowed, tostring(tokens)}
+`
+
+//redisLimiter is the Implementation of Limiter with the buckets in Redis
+type redisLimiter struct {
+	eval evaler
+	keys cache.KeyBuilder
+	opts Options
+	now  func() time.Time
+}
+
+//Allow takes a token from the bucket of a client
+func (l *redisLimiter) Allow(ctx context.Context, client string) (Decision, error) {
+	now := l.now().UnixNano() / int64(time.Millisecond)
+	res, err := l.eval.Eval(ctx, bucketScript, []string{l.keys.Bucket(l.opts.Name, client)},
+		l.opts.Rate, l.opts.Burst, now, int64(l.opts.ttl()/time.Millisecond))
+	if err != nil {
+		return Decision{Allowed: true}, err
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return Decision{Allowed: true}, fmt.Errorf("unexpected token bucket script result %v", res)
+	}
+	tokens, err := strconv.ParseFloat(fmt.Sprint(values[1]), 64)
+	if err != nil {
+		return Decision{Allowed: true}, err
+	}
+	d := Decision{Allowed: values[0] == int64(1), Remaining: int64(math.Floor(tokens))}
+	if !d.Allowed {
+		d.RetryAfter = l.opts.retryAfter(tokens)
+	}
+	return d, nil
+}
+
+//bucket is the state of a local token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+//localLimiter is the Implementation of Limiter with the buckets in memory
+type localLimiter struct {
+	mutex   sync.Mutex
+	opts    Options
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+//NewLocal returns a Limiter with the buckets in memory
+func NewLocal(opts Options) Limiter {
+	return &localLimiter{
+		opts:    opts,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+//Allow takes a token from the bucket of a client
+func (l *localLimiter) Allow(ctx context.Context, client string) (Decision, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(l.opts.Burst), last: now}
+		l.buckets[client] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(l.opts.Burst), b.tokens+elapsed.Seconds()*l.opts.Rate)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return Decision{Remaining: 0, RetryAfter: l.opts.retryAfter(b.tokens)}, nil
+	}
+	b.tokens--
+	return Decision{Allowed: true, Remaining: int64(math.Floor(b.tokens))}, nil
+}
+
+//sweep removes the buckets that are full again, they are the same as a new bucket
+func (l *localLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < SweepInterval {
+		return
+	}
+	l.swept = now
+	ttl := l.opts.ttl()
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > ttl {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jpiriz/ghcontrib/pkg/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	s    *miniredis.Miniredis
+	c    cache.RedisCache
+	keys cache.KeyBuilder
+	ctx  context.Context
+)
+
+func TestMain(m *testing.M) {
+	s, _ = miniredis.Run()
+	c, _ = cache.NewRedisCache(cache.RedisOptions{Addrs: []string{s.Addr()}, Lock: cache.DefaultLockOptions()})
+	keys = cache.NewKeyBuilder("test")
+	ctx = context.Background()
+	os.Exit(m.Run())
+}
+
+//testBucket takes the burst of a limiter and checks the refill
+func testBucket(t *testing.T, l Limiter, now *time.Time) {
+	for i := int64(2); i >= 0; i-- {
+		d, err := l.Allow(ctx, "client")
+		assert.NoError(t, err)
+		assert.True(t, d.Allowed)
+		assert.Equal(t, i, d.Remaining)
+	}
+	d, err := l.Allow(ctx, "client")
+	assert.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+
+	// Other clients have their own bucket
+	d, _ = l.Allow(ctx, "other")
+	assert.True(t, d.Allowed)
+
+	*now = now.Add(time.Second)
+	d, _ = l.Allow(ctx, "client")
+	assert.True(t, d.Allowed)
+	d, _ = l.Allow(ctx, "client")
+	assert.False(t, d.Allowed)
+}
+
+func TestRedisLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(c, keys, Options{Name: "requests", Rate: 1, Burst: 3})
+	rl, ok := l.(*redisLimiter)
+	assert.True(t, ok)
+	rl.now = func() time.Time { return now }
+	testBucket(t, l, &now)
+	assert.True(t, s.Exists(keys.Bucket("requests", "client")))
+}
+
+func TestLocalLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewLocal(Options{Name: "requests", Rate: 1, Burst: 3})
+	l.(*localLimiter).now = func() time.Time { return now }
+	testBucket(t, l, &now)
+}
+
+func TestLocalLimiterSweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewLocal(Options{Name: "requests", Rate: 1, Burst: 3}).(*localLimiter)
+	l.now = func() time.Time { return now }
+	l.Allow(ctx, "idle")
+	now = now.Add(2 * SweepInterval)
+	l.Allow(ctx, "active")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestNewWithoutScripts(t *testing.T) {
+	b, err := cache.NewBoltCache(filepath.Join(t.TempDir(), "cache.db"), cache.DefaultLockOptions())
+	assert.NoError(t, err)
+	defer b.Close()
+	_, ok := New(b, keys, Options{Name: "requests", Rate: 1, Burst: 1}).(*localLimiter)
+	assert.True(t, ok)
+}